@@ -2,6 +2,7 @@ package broadcast
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // Broadcast implements notifying waiters via a channel.
@@ -10,6 +11,8 @@ import (
 type Broadcast struct {
 	mtx sync.Mutex
 	ch  *broadcastWaitCh
+	// held is the debug state of the current holder, nil if debug is off
+	held atomic.Pointer[lockDebug]
 }
 
 type broadcastWaitCh struct {
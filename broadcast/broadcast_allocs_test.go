@@ -1,4 +1,4 @@
-//go:build !goscript
+//go:build !goscript && !broadcast_debug
 
 package broadcast
 
@@ -14,7 +14,7 @@ import (
 func (c *Broadcast) HoldLock(cb func(broadcast func(), getWaitCh func() <-chan struct{})) {
 	locked := c.Lock()
 	defer locked.Unlock()
-	cb(c.broadcastLockedFunc(), c.waitChLockedFunc())
+	cb(c.broadcastLockedFunc(locked.dbg), c.waitChLockedFunc(locked.dbg))
 }
 
 // TryHoldLock attempts to lock the mutex and call the callback.
@@ -27,7 +27,7 @@ func (c *Broadcast) TryHoldLock(cb func(broadcast func(), getWaitCh func() <-cha
 		return false
 	}
 	defer locked.Unlock()
-	cb(c.broadcastLockedFunc(), c.waitChLockedFunc())
+	cb(c.broadcastLockedFunc(locked.dbg), c.waitChLockedFunc(locked.dbg))
 	return true
 }
 
@@ -37,19 +37,18 @@ func (c *Broadcast) TryHoldLock(cb func(broadcast func(), getWaitCh func() <-cha
 // for it. This is a compatibility helper for callback-shaped callers; direct
 // hot paths should use Lock or TryLock.
 func (c *Broadcast) HoldLockMaybeAsync(cb func(broadcast func(), getWaitCh func() <-chan struct{})) {
-	holdBroadcastLock := func(lock bool) {
-		if lock {
-			c.mtx.Lock()
-		}
-		defer c.mtx.Unlock()
-		cb(c.broadcastLockedFunc(), c.waitChLockedFunc())
+	holdBroadcastLock := func(locked Locked) {
+		defer locked.Unlock()
+		cb(c.broadcastLockedFunc(locked.dbg), c.waitChLockedFunc(locked.dbg))
 	}
 
-	if c.mtx.TryLock() {
-		holdBroadcastLock(false)
+	if locked, ok := c.TryLock(); ok {
+		holdBroadcastLock(locked)
 		return
 	}
-	go holdBroadcastLock(true)
+	go func() {
+		holdBroadcastLock(c.Lock())
+	}()
 }
 
 // Wait waits for the callback to return true or an error before returning.
@@ -71,8 +70,8 @@ func (c *Broadcast) Wait(ctx context.Context, cb func(broadcast func(), getWaitC
 		var done bool
 		var err error
 		locked := c.Lock()
-		broadcast := c.broadcastLockedFunc()
-		getWaitCh := c.waitChLockedFunc()
+		broadcast := c.broadcastLockedFunc(locked.dbg)
+		getWaitCh := c.waitChLockedFunc(locked.dbg)
 		done, err = cb(broadcast, getWaitCh)
 		if !done && err == nil {
 			waitCh = getWaitCh()
@@ -94,9 +93,13 @@ func (c *Broadcast) Wait(ctx context.Context, cb func(broadcast func(), getWaitC
 // broadcastLockedFunc returns a callback-shaped broadcast operation for
 // HoldLock compatibility callers. Keep this as a plain closure rather than a
 // bound Locked method value: TinyGo browser wasm has trapped in channel close
-// paths reached through bound method callbacks.
-func (c *Broadcast) broadcastLockedFunc() func() {
+// paths reached through bound method callbacks. dbg is the debug state of the
+// held lock, if any.
+func (c *Broadcast) broadcastLockedFunc(dbg *lockDebug) func() {
 	return func() {
+		if dbg != nil && !c.debugCheckHeld(dbg, "broadcast") {
+			return
+		}
 		if c.ch == nil {
 			return
 		}
@@ -108,8 +111,11 @@ func (c *Broadcast) broadcastLockedFunc() func() {
 
 // waitChLockedFunc returns a callback-shaped wait subscription operation for
 // HoldLock compatibility callers.
-func (c *Broadcast) waitChLockedFunc() func() <-chan struct{} {
+func (c *Broadcast) waitChLockedFunc(dbg *lockDebug) func() <-chan struct{} {
 	return func() <-chan struct{} {
+		if dbg != nil && !c.debugCheckHeld(dbg, "getWaitCh") {
+			return closedWaitCh
+		}
 		if c.ch == nil {
 			c.ch = newBroadcastWaitCh()
 		}
@@ -0,0 +1,256 @@
+package broadcast
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDebugHoldThreshold is the hold threshold used by the broadcast_debug
+// build tag.
+const DefaultDebugHoldThreshold = time.Second
+
+// DebugIssue is a kind of lock misuse reported in debug mode.
+type DebugIssue int
+
+const (
+	// DebugLongHold is reported when a lock is held past the hold threshold.
+	DebugLongHold DebugIssue = iota
+	// DebugUseAfterUnlock is reported when a Locked value is used after
+	// Unlock, or a copy of it is used after another copy was unlocked.
+	DebugUseAfterUnlock
+	// DebugReentrantLock is reported when a goroutine locks a Broadcast that
+	// it already holds, which would deadlock.
+	DebugReentrantLock
+)
+
+// String returns the name of the issue.
+func (i DebugIssue) String() string {
+	switch i {
+	case DebugLongHold:
+		return "long-held lock"
+	case DebugUseAfterUnlock:
+		return "use after unlock"
+	case DebugReentrantLock:
+		return "reentrant lock"
+	default:
+		return "unknown"
+	}
+}
+
+// DebugReport describes a lock misuse detected in debug mode.
+type DebugReport struct {
+	// Issue is the kind of misuse.
+	Issue DebugIssue
+	// Op is the operation that detected the misuse.
+	Op string
+	// AcquiredAt is the stack where the lock was acquired, if known.
+	AcquiredAt string
+	// HeldFor is how long the lock had been held, if known.
+	HeldFor time.Duration
+	// Stack is the stack of the offending call.
+	// Empty for DebugLongHold, which is reported from a timer.
+	Stack string
+}
+
+// String formats the report.
+func (r *DebugReport) String() string {
+	var sb strings.Builder
+	sb.WriteString("broadcast: ")
+	sb.WriteString(r.Issue.String())
+	if r.Op != "" {
+		sb.WriteString(" in ")
+		sb.WriteString(r.Op)
+	}
+	if r.HeldFor != 0 {
+		sb.WriteString(" (held for ")
+		sb.WriteString(r.HeldFor.String())
+		sb.WriteString(")")
+	}
+	sb.WriteString("\n")
+	if r.AcquiredAt != "" {
+		sb.WriteString("lock acquired at:\n")
+		sb.WriteString(r.AcquiredAt)
+	}
+	if r.Stack != "" {
+		sb.WriteString("called from:\n")
+		sb.WriteString(r.Stack)
+	}
+	return sb.String()
+}
+
+// DebugConfig configures debug mode.
+type DebugConfig struct {
+	// HoldThreshold reports locks held for longer than this duration.
+	// If zero, long-held locks are not reported.
+	HoldThreshold time.Duration
+	// OnReport is called for each detected misuse.
+	// If nil, the report is written to stderr.
+	// Called without holding any broadcast lock.
+	OnReport func(r *DebugReport)
+}
+
+// debugConf is the active debug configuration, nil if disabled.
+var debugConf atomic.Pointer[DebugConfig]
+
+// SetDebug enables debug mode with the given config, or disables it if nil.
+//
+// In debug mode every Lock records the acquiring goroutine and stack so that
+// long-held locks, use of a Locked value after Unlock, and reentrant locking
+// can be reported. This adds allocations and stack captures to every lock, so
+// enable it only while tracking down bugs. Locks acquired before debug mode was
+// enabled are not tracked. Building with the broadcast_debug tag enables debug
+// mode at init with DefaultDebugHoldThreshold.
+func SetDebug(conf *DebugConfig) {
+	debugConf.Store(conf)
+}
+
+// report delivers a debug report.
+func (c *DebugConfig) report(r *DebugReport) {
+	if c.OnReport != nil {
+		c.OnReport(r)
+		return
+	}
+	_, _ = os.Stderr.WriteString(r.String())
+}
+
+// closedWaitCh is returned by WaitCh on misuse so that callers re-check their
+// state instead of blocking forever.
+var closedWaitCh = func() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// lockDebug is the debug state for a single held lock.
+type lockDebug struct {
+	conf     *DebugConfig
+	gid      uint64
+	acquired time.Time
+	pcs      []uintptr
+	timer    *time.Timer
+}
+
+// debugLockLocked records a newly acquired lock.
+// expects mtx to be locked by caller
+func (c *Broadcast) debugLockLocked(conf *DebugConfig) *lockDebug {
+	d := &lockDebug{
+		conf:     conf,
+		gid:      curGoroutineID(),
+		acquired: time.Now(),
+		pcs:      callerPCs(4),
+	}
+	if conf.HoldThreshold > 0 {
+		d.timer = time.AfterFunc(conf.HoldThreshold, func() {
+			if c.held.Load() != d {
+				return
+			}
+			conf.report(&DebugReport{
+				Issue:      DebugLongHold,
+				Op:         "Lock",
+				AcquiredAt: formatPCs(d.pcs),
+				HeldFor:    time.Since(d.acquired),
+			})
+		})
+	}
+	c.held.Store(d)
+	return d
+}
+
+// debugCheckReentrant reports if the current goroutine already holds the lock.
+func (c *Broadcast) debugCheckReentrant(conf *DebugConfig) {
+	held := c.held.Load()
+	if held == nil || held.gid != curGoroutineID() {
+		return
+	}
+	conf.report(&DebugReport{
+		Issue:      DebugReentrantLock,
+		Op:         "Lock",
+		AcquiredAt: formatPCs(held.pcs),
+		HeldFor:    time.Since(held.acquired),
+		Stack:      formatPCs(callerPCs(4)),
+	})
+}
+
+// debugCheck reports if the Locked value is no longer the current holder.
+// Returns false if the operation must be skipped.
+func (l *Locked) debugCheck(op string) bool {
+	if l.b == nil {
+		if l.dbg != nil {
+			l.dbg.reportUseAfterUnlock(op)
+			return false
+		}
+		// not tracked: preserve the nil dereference panic
+		return true
+	}
+	return l.b.debugCheckHeld(l.dbg, op)
+}
+
+// debugCheckHeld reports if dbg is no longer the current holder.
+// Returns false if the operation must be skipped.
+func (c *Broadcast) debugCheckHeld(dbg *lockDebug, op string) bool {
+	if dbg == nil || c.held.Load() == dbg {
+		return true
+	}
+	dbg.reportUseAfterUnlock(op)
+	return false
+}
+
+// reportUseAfterUnlock reports a use of the lock after it was released.
+func (d *lockDebug) reportUseAfterUnlock(op string) {
+	d.conf.report(&DebugReport{
+		Issue:      DebugUseAfterUnlock,
+		Op:         op,
+		AcquiredAt: formatPCs(d.pcs),
+		Stack:      formatPCs(callerPCs(4)),
+	})
+}
+
+// debugUnlockLocked clears the debug state before unlocking.
+// expects mtx to be locked by caller
+func (l *Locked) debugUnlockLocked() {
+	if l.dbg.timer != nil {
+		l.dbg.timer.Stop()
+	}
+	l.b.held.Store(nil)
+}
+
+// callerPCs captures the stack skipping skip frames.
+func callerPCs(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	return pcs[:runtime.Callers(skip, pcs)]
+}
+
+// formatPCs formats a captured stack.
+func formatPCs(pcs []uintptr) string {
+	if len(pcs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// curGoroutineID parses the current goroutine id from the stack header.
+func curGoroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
@@ -0,0 +1,7 @@
+//go:build broadcast_debug
+
+package broadcast
+
+func init() {
+	SetDebug(&DebugConfig{HoldThreshold: DefaultDebugHoldThreshold})
+}
@@ -0,0 +1,135 @@
+package broadcast
+
+import (
+	"testing"
+	"time"
+)
+
+// setTestDebug enables debug mode for the test and returns the report channel.
+func setTestDebug(t *testing.T, holdThreshold time.Duration) <-chan *DebugReport {
+	reports := make(chan *DebugReport, 8)
+	prev := debugConf.Load()
+	SetDebug(&DebugConfig{
+		HoldThreshold: holdThreshold,
+		OnReport: func(r *DebugReport) {
+			reports <- r
+		},
+	})
+	t.Cleanup(func() { SetDebug(prev) })
+	return reports
+}
+
+func TestDebug_LongHold(t *testing.T) {
+	reports := setTestDebug(t, 10*time.Millisecond)
+
+	var bc Broadcast
+	locked := bc.Lock()
+	select {
+	case r := <-reports:
+		if r.Issue != DebugLongHold || r.AcquiredAt == "" {
+			t.Fatalf("unexpected report: %v", r.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected long hold report")
+	}
+	locked.Unlock()
+
+	// a short hold is not reported
+	locked = bc.Lock()
+	locked.Unlock()
+	select {
+	case r := <-reports:
+		t.Fatalf("unexpected report: %v", r.String())
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestDebug_UseAfterUnlock(t *testing.T) {
+	reports := setTestDebug(t, 0)
+
+	var bc Broadcast
+	locked := bc.Lock()
+	waitCh := locked.WaitCh()
+	stale := locked
+	locked.Unlock()
+
+	locked.Broadcast()
+	if r := <-reports; r.Issue != DebugUseAfterUnlock || r.Op != "Broadcast" {
+		t.Fatalf("unexpected report: %v", r.String())
+	}
+	stale.Broadcast()
+	if r := <-reports; r.Issue != DebugUseAfterUnlock || r.Op != "Broadcast" {
+		t.Fatalf("unexpected report: %v", r.String())
+	}
+	select {
+	case <-waitCh:
+		t.Fatal("broadcast after unlock should be skipped")
+	default:
+	}
+
+	// a stale copy must not unlock the next holder
+	next := bc.Lock()
+	stale.Unlock()
+	if r := <-reports; r.Issue != DebugUseAfterUnlock || r.Op != "Unlock" {
+		t.Fatalf("unexpected report: %v", r.String())
+	}
+	if _, ok := bc.TryLock(); ok {
+		t.Fatal("stale unlock released the lock")
+	}
+	next.Unlock()
+
+	var bcast func()
+	bc.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		bcast = broadcast
+	})
+	bcast()
+	if r := <-reports; r.Issue != DebugUseAfterUnlock || r.Op != "broadcast" {
+		t.Fatalf("unexpected report: %v", r.String())
+	}
+}
+
+func TestDebug_Reentrant(t *testing.T) {
+	reports := setTestDebug(t, 0)
+
+	var bc Broadcast
+	first := make(chan Locked, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		locked := bc.Lock()
+		first <- locked
+		// deadlocks until the first lock is released below
+		inner := bc.Lock()
+		inner.Unlock()
+	}()
+
+	locked := <-first
+	select {
+	case r := <-reports:
+		if r.Issue != DebugReentrantLock || r.AcquiredAt == "" || r.Stack == "" {
+			t.Fatalf("unexpected report: %v", r.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected reentrant lock report")
+	}
+	locked.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("goroutine did not exit")
+	}
+}
+
+func TestDebug_Disabled(t *testing.T) {
+	prev := debugConf.Load()
+	SetDebug(nil)
+	defer SetDebug(prev)
+
+	var bc Broadcast
+	locked := bc.Lock()
+	if locked.dbg != nil {
+		t.Fatal("expected no debug state with debug disabled")
+	}
+	locked.Unlock()
+}
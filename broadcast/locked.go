@@ -8,7 +8,8 @@ package broadcast
 // closures and keeps the state check next to the optional wait subscription.
 // Call Unlock exactly once, and do not copy a Locked value after use.
 type Locked struct {
-	b *Broadcast
+	b   *Broadcast
+	dbg *lockDebug
 }
 
 // Lock locks the broadcast and returns a held lock guard.
@@ -17,6 +18,11 @@ type Locked struct {
 // callers can inspect guarded state, call WaitCh only when they must block, and
 // call Broadcast without allocating callback operation closures.
 func (c *Broadcast) Lock() Locked {
+	if conf := debugConf.Load(); conf != nil {
+		c.debugCheckReentrant(conf)
+		c.mtx.Lock()
+		return Locked{b: c, dbg: c.debugLockLocked(conf)}
+	}
 	c.mtx.Lock()
 	return Locked{b: c}
 }
@@ -26,11 +32,20 @@ func (c *Broadcast) TryLock() (Locked, bool) {
 	if !c.mtx.TryLock() {
 		return Locked{}, false
 	}
+	if conf := debugConf.Load(); conf != nil {
+		return Locked{b: c, dbg: c.debugLockLocked(conf)}, true
+	}
 	return Locked{b: c}, true
 }
 
 // Unlock releases the held broadcast lock.
 func (l *Locked) Unlock() {
+	if l.dbg != nil {
+		if !l.debugCheck("Unlock") {
+			return
+		}
+		l.debugUnlockLocked()
+	}
 	l.b.mtx.Unlock()
 	l.b = nil
 }
@@ -41,6 +56,9 @@ func (l *Locked) Unlock() {
 // state. Waiters that already called WaitCh wake from the closed channel, and a
 // later WaitCh call allocates the next epoch.
 func (l *Locked) Broadcast() {
+	if l.dbg != nil && !l.debugCheck("Broadcast") {
+		return
+	}
 	if l.b.ch == nil {
 		return
 	}
@@ -54,6 +72,9 @@ func (l *Locked) Broadcast() {
 // WaitCh allocates the wait epoch lazily, so callers should call it only after
 // they have checked the guarded state and determined they really need to block.
 func (l *Locked) WaitCh() <-chan struct{} {
+	if l.dbg != nil && !l.debugCheck("WaitCh") {
+		return closedWaitCh
+	}
 	if l.b.ch == nil {
 		l.b.ch = newBroadcastWaitCh()
 	}
@@ -0,0 +1,125 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+)
+
+// Value is a value guarded by a Broadcast with a monotonic version number.
+//
+// Every Store or Update increments the version, even if the new value is equal
+// to the previous one. Waiters compare versions instead of values, so a change
+// A -> B -> A between wakeups is still observed, and a waiter can tell how many
+// versions it skipped by subtracting the version numbers.
+//
+// The zero-value of this struct is valid and holds the zero value of T at
+// version 0.
+type Value[T any] struct {
+	bcast Broadcast
+	val   T
+	ver   uint64
+}
+
+// NewValue constructs a new Value with an initial value at version 0.
+func NewValue[T any](val T) *Value[T] {
+	return &Value[T]{val: val}
+}
+
+// Load returns the current value and version.
+func (v *Value[T]) Load() (T, uint64) {
+	locked := v.bcast.Lock()
+	val, ver := v.val, v.ver
+	locked.Unlock()
+	return val, ver
+}
+
+// Version returns the current version.
+func (v *Value[T]) Version() uint64 {
+	locked := v.bcast.Lock()
+	ver := v.ver
+	locked.Unlock()
+	return ver
+}
+
+// Store sets the value, increments the version, and wakes any waiters.
+//
+// Returns the new version.
+func (v *Value[T]) Store(val T) uint64 {
+	locked := v.bcast.Lock()
+	v.val = val
+	v.ver++
+	ver := v.ver
+	locked.Broadcast()
+	locked.Unlock()
+	return ver
+}
+
+// Update calls cb with the current value under the lock and stores the result.
+//
+// The version is incremented and waiters are woken. Returns the new value and
+// version. cb must not call other methods on the Value.
+func (v *Value[T]) Update(cb func(val T) T) (T, uint64) {
+	locked := v.bcast.Lock()
+	v.val = cb(v.val)
+	v.ver++
+	val, ver := v.val, v.ver
+	locked.Broadcast()
+	locked.Unlock()
+	return val, ver
+}
+
+// WaitNewer waits for the version to be greater than sinceVersion.
+//
+// Returns the current value and version as soon as the version is newer, which
+// may be more than one version ahead if several changes happened in between.
+// Returns context.Canceled if ctx is canceled.
+func (v *Value[T]) WaitNewer(ctx context.Context, sinceVersion uint64) (T, uint64, error) {
+	if ctx == nil {
+		var empty T
+		return empty, 0, errors.New("ctx must be set")
+	}
+	for {
+		if ctx.Err() != nil {
+			var empty T
+			return empty, 0, context.Canceled
+		}
+
+		locked := v.bcast.Lock()
+		if v.ver > sinceVersion {
+			val, ver := v.val, v.ver
+			locked.Unlock()
+			return val, ver, nil
+		}
+		waitCh := locked.WaitCh()
+		locked.Unlock()
+
+		select {
+		case <-ctx.Done():
+			var empty T
+			return empty, 0, context.Canceled
+		case <-waitCh:
+		}
+	}
+}
+
+// Watch calls cb with the current value and each newer version until ctx is
+// canceled or cb returns an error.
+//
+// skipped is the number of versions that were replaced before they could be
+// observed since the previous call. cb is called outside the lock.
+func (v *Value[T]) Watch(ctx context.Context, cb func(val T, version uint64, skipped uint64) error) error {
+	val, ver := v.Load()
+	if err := cb(val, ver, 0); err != nil {
+		return err
+	}
+	for {
+		nval, nver, err := v.WaitNewer(ctx, ver)
+		if err != nil {
+			return err
+		}
+		if err := cb(nval, nver, nver-ver-1); err != nil {
+			return err
+		}
+		ver = nver
+	}
+}
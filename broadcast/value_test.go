@@ -0,0 +1,124 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValue_StoreLoad(t *testing.T) {
+	var v Value[int]
+	if val, ver := v.Load(); val != 0 || ver != 0 {
+		t.Fatalf("expected zero value at version 0, got %d@%d", val, ver)
+	}
+	if ver := v.Store(5); ver != 1 {
+		t.Fatalf("expected version 1, got %d", ver)
+	}
+	val, ver := v.Update(func(val int) int { return val + 1 })
+	if val != 6 || ver != 2 {
+		t.Fatalf("expected 6@2, got %d@%d", val, ver)
+	}
+	if ver := v.Version(); ver != 2 {
+		t.Fatalf("expected version 2, got %d", ver)
+	}
+}
+
+func TestValue_WaitNewerABA(t *testing.T) {
+	ctx := t.Context()
+	v := NewValue("a")
+	_, since := v.Load()
+
+	done := make(chan uint64, 1)
+	go func() {
+		val, ver, err := v.WaitNewer(ctx, since)
+		if err != nil || val != "a" {
+			done <- 0
+			return
+		}
+		done <- ver
+	}()
+
+	// a -> b -> a is still observed as a change.
+	locked := v.bcast.Lock()
+	v.val = "b"
+	v.ver++
+	locked.Unlock()
+	v.Store("a")
+
+	select {
+	case ver := <-done:
+		if ver != 2 {
+			t.Fatalf("expected version 2, got %d", ver)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitNewer did not return")
+	}
+}
+
+func TestValue_WaitNewerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := NewValue(1)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := v.WaitNewer(ctx, 0)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("WaitNewer returned early: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitNewer did not return after cancel")
+	}
+}
+
+func TestValue_WatchReportsSkipped(t *testing.T) {
+	ctx := t.Context()
+	v := NewValue(0)
+	v.Store(1)
+	v.Store(2)
+
+	errDone := errors.New("done")
+	var got []uint64
+	var skips []uint64
+	go func() {
+		<-time.After(10 * time.Millisecond)
+		v.Store(3)
+		v.Store(4)
+		v.Store(5)
+	}()
+	err := v.Watch(ctx, func(val int, ver, skipped uint64) error {
+		got = append(got, ver)
+		skips = append(skips, skipped)
+		if val == 5 {
+			return errDone
+		}
+		return nil
+	})
+	if err != errDone {
+		t.Fatalf("expected errDone, got %v", err)
+	}
+	if got[0] != 2 || skips[0] != 0 {
+		t.Fatalf("expected initial version 2, got %d (skipped %d)", got[0], skips[0])
+	}
+	var total uint64
+	for i := 1; i < len(got); i++ {
+		if got[i] != got[i-1]+skips[i]+1 {
+			t.Fatalf("version %d does not account for %d skipped after %d", got[i], skips[i], got[i-1])
+		}
+		total += skips[i] + 1
+	}
+	if total != 3 {
+		t.Fatalf("expected 3 versions observed or skipped, got %d", total)
+	}
+}
@@ -3,6 +3,7 @@ package broadcast
 import (
 	"context"
 	"errors"
+	"reflect"
 	"sync"
 )
 
@@ -77,3 +78,193 @@ func waitAnyFanIn(ctx context.Context, waitChs []<-chan struct{}) error {
 		return nil
 	}
 }
+
+// WaitAnyIndex waits until ctx is canceled or any non-nil wait channel is
+// closed, and returns the index of the channel that fired.
+//
+// The index refers to the position in waitChs, including nil entries, which are
+// ignored. If several channels are closed, one of them is chosen at random.
+// Unlike WaitAny, WaitAnyIndex does not start goroutines; multiple channels are
+// multiplexed with reflect.Select. Returns -1 and the context error if ctx is
+// canceled first.
+func WaitAnyIndex(ctx context.Context, waitChs ...<-chan struct{}) (int, error) {
+	if ctx == nil {
+		return -1, errors.New("ctx must be set")
+	}
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
+	var sel Selector
+	sel.Set(waitChs...)
+	return sel.Wait(ctx)
+}
+
+// WaitAll waits until ctx is canceled or every non-nil wait channel is closed.
+//
+// Nil channels are ignored. Wait channels stay closed once closed, so the
+// channels are waited on in order without starting goroutines.
+func WaitAll(ctx context.Context, waitChs ...<-chan struct{}) error {
+	if ctx == nil {
+		return errors.New("ctx must be set")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, ch := range waitChs {
+		if ch == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+	return nil
+}
+
+// WaitN waits until ctx is canceled or at least n non-nil wait channels are
+// closed.
+//
+// Nil channels are ignored. Returns nil immediately if n <= 0, and an error if
+// n is greater than the number of non-nil wait channels.
+func WaitN(ctx context.Context, n int, waitChs ...<-chan struct{}) error {
+	if ctx == nil {
+		return errors.New("ctx must be set")
+	}
+	if n <= 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var sel Selector
+	sel.Set(waitChs...)
+	if n > sel.Active() {
+		return errors.New("n exceeds the number of wait channels")
+	}
+	for ; n > 0; n-- {
+		idx, err := sel.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		// closed channels always fire: stop selecting on them
+		sel.Replace(idx, nil)
+	}
+	return nil
+}
+
+// Selector waits on a changing set of wait channels without goroutines.
+//
+// The select cases are kept between calls to Wait, so watch loops can replace
+// the channel that fired with the next wait channel from the same source and
+// wait again without reallocating. Nil channels are ignored but keep their
+// index. Selector uses reflect.Select and is not safe for concurrent use.
+//
+// The zero-value of this struct is valid.
+type Selector struct {
+	// cases contains the ctx case at index 0 followed by the wait channels
+	cases []reflect.SelectCase
+	// active is the number of non-nil wait channels
+	active int
+}
+
+// NewSelector constructs a new Selector with the given wait channels.
+func NewSelector(waitChs ...<-chan struct{}) *Selector {
+	s := &Selector{}
+	s.Set(waitChs...)
+	return s
+}
+
+// Len returns the number of wait channels including nil entries.
+func (s *Selector) Len() int {
+	if len(s.cases) == 0 {
+		return 0
+	}
+	return len(s.cases) - 1
+}
+
+// Active returns the number of non-nil wait channels.
+func (s *Selector) Active() int {
+	return s.active
+}
+
+// Reset removes all wait channels, keeping the allocated capacity.
+func (s *Selector) Reset() {
+	clear(s.cases)
+	s.cases = s.cases[:0]
+	s.active = 0
+}
+
+// Set replaces all wait channels with waitChs.
+func (s *Selector) Set(waitChs ...<-chan struct{}) {
+	s.Reset()
+	for _, ch := range waitChs {
+		s.Add(ch)
+	}
+}
+
+// Add appends a wait channel and returns its index.
+func (s *Selector) Add(ch <-chan struct{}) int {
+	if len(s.cases) == 0 {
+		s.cases = append(s.cases, reflect.SelectCase{Dir: reflect.SelectRecv})
+	}
+	s.cases = append(s.cases, selectRecvCase(ch))
+	if ch != nil {
+		s.active++
+	}
+	return len(s.cases) - 2
+}
+
+// Replace replaces the wait channel at idx.
+//
+// Pass nil to stop waiting on idx while keeping the other indexes stable.
+func (s *Selector) Replace(idx int, ch <-chan struct{}) {
+	c := &s.cases[idx+1]
+	if c.Chan.IsValid() {
+		s.active--
+	}
+	*c = selectRecvCase(ch)
+	if ch != nil {
+		s.active++
+	}
+}
+
+// Wait waits until ctx is canceled or any non-nil wait channel is closed.
+//
+// Returns the index of the channel that fired. If there are no non-nil wait
+// channels, Wait waits for ctx cancellation. Returns -1 and the context error
+// if ctx is canceled first.
+func (s *Selector) Wait(ctx context.Context) (int, error) {
+	if ctx == nil {
+		return -1, errors.New("ctx must be set")
+	}
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	if len(s.cases) == 0 {
+		s.cases = append(s.cases, reflect.SelectCase{Dir: reflect.SelectRecv})
+	}
+
+	s.cases[0] = selectRecvCase(ctx.Done())
+	chosen, _, _ := reflect.Select(s.cases)
+	// do not retain ctx between waits
+	s.cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv}
+	if chosen == 0 {
+		return -1, ctx.Err()
+	}
+	return chosen - 1, nil
+}
+
+// selectRecvCase builds a receive case for ch.
+//
+// A nil channel produces a case with no channel, which reflect.Select ignores.
+func selectRecvCase(ch <-chan struct{}) reflect.SelectCase {
+	c := reflect.SelectCase{Dir: reflect.SelectRecv}
+	if ch != nil {
+		c.Chan = reflect.ValueOf(ch)
+	}
+	return c
+}
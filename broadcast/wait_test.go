@@ -112,3 +112,153 @@ func TestWaitAny_NoIgnoredSources(t *testing.T) {
 		}
 	}
 }
+
+func TestWaitAnyIndex_ReportsIndex(t *testing.T) {
+	ctx := t.Context()
+	chans := make([]chan struct{}, 4)
+	waitChs := []<-chan struct{}{nil}
+	for i := range chans {
+		chans[i] = make(chan struct{})
+		waitChs = append(waitChs, chans[i])
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		idx, err := WaitAnyIndex(ctx, waitChs...)
+		if err != nil {
+			idx = -2
+		}
+		done <- idx
+	}()
+
+	select {
+	case idx := <-done:
+		t.Fatalf("WaitAnyIndex returned before wake: %d", idx)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(chans[2])
+
+	select {
+	case idx := <-done:
+		if idx != 3 {
+			t.Fatalf("expected index 3, got %d", idx)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitAnyIndex did not return after wake")
+	}
+}
+
+func TestWaitAnyIndex_ContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	idx, err := WaitAnyIndex(ctx, make(chan struct{}))
+	if idx != -1 || err != context.Canceled {
+		t.Fatalf("expected -1 and context.Canceled, got %d, %v", idx, err)
+	}
+}
+
+func TestWaitAll(t *testing.T) {
+	ctx := t.Context()
+	a, b := make(chan struct{}), make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitAll(ctx, a, nil, b)
+	}()
+
+	close(b)
+	select {
+	case err := <-done:
+		t.Fatalf("WaitAll returned before all channels closed: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(a)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitAll did not return")
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	ctx := t.Context()
+	chans := make([]chan struct{}, 3)
+	waitChs := make([]<-chan struct{}, len(chans))
+	for i := range chans {
+		chans[i] = make(chan struct{})
+		waitChs[i] = chans[i]
+	}
+
+	if err := WaitN(ctx, 4, waitChs...); err == nil {
+		t.Fatal("expected error for n greater than channel count")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitN(ctx, 2, waitChs...)
+	}()
+
+	close(chans[1])
+	select {
+	case err := <-done:
+		t.Fatalf("WaitN returned after one channel: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(chans[0])
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WaitN did not return")
+	}
+}
+
+func TestSelector_Replace(t *testing.T) {
+	ctx := t.Context()
+	var bcasts [3]Broadcast
+	sel := NewSelector()
+	for i := range bcasts {
+		locked := bcasts[i].Lock()
+		if idx := sel.Add(locked.WaitCh()); idx != i {
+			t.Fatalf("expected index %d, got %d", i, idx)
+		}
+		locked.Unlock()
+	}
+
+	for round := range 6 {
+		src := (round * 2) % len(bcasts)
+		locked := bcasts[src].Lock()
+		locked.Broadcast()
+		locked.Unlock()
+
+		idx, err := sel.Wait(ctx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if idx != src {
+			t.Fatalf("round %d: expected index %d, got %d", round, src, idx)
+		}
+
+		locked = bcasts[idx].Lock()
+		sel.Replace(idx, locked.WaitCh())
+		locked.Unlock()
+	}
+
+	sel.Replace(1, nil)
+	if sel.Len() != 3 || sel.Active() != 2 {
+		t.Fatalf("expected 3 channels with 2 active, got %d and %d", sel.Len(), sel.Active())
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if idx, err := sel.Wait(cctx); idx != -1 || err != context.Canceled {
+		t.Fatalf("expected -1 and context.Canceled, got %d, %v", idx, err)
+	}
+}
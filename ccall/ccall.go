@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/aperturerobotics/util/broadcast"
+	"github.com/aperturerobotics/util/panics"
 )
 
 // CallConcurrentlyFunc is a function passed to CallConcurrently.
@@ -11,14 +12,33 @@ type CallConcurrentlyFunc = func(ctx context.Context) error
 
 // CallConcurrently calls multiple functions concurrently and waits for exit or error.
 func CallConcurrently(ctx context.Context, fns ...CallConcurrentlyFunc) error {
+	return callConcurrently(ctx, false, fns)
+}
+
+// CallConcurrentlyRecover calls multiple functions concurrently and waits for exit or error.
+//
+// Recovers panics in the functions and returns them as a *panics.PanicError.
+// Calls the global hook set with panics.SetHook.
+func CallConcurrentlyRecover(ctx context.Context, fns ...CallConcurrentlyFunc) error {
+	return callConcurrently(ctx, true, fns)
+}
+
+// callConcurrently implements CallConcurrently.
+func callConcurrently(ctx context.Context, recoverPanics bool, fns []CallConcurrentlyFunc) error {
 	if len(fns) == 0 {
 		return nil
 	}
 
 	subCtx, subCtxCancel := context.WithCancel(ctx)
 	defer subCtxCancel()
+	callFn := func(fn CallConcurrentlyFunc) error {
+		if recoverPanics {
+			return panics.Call(func() error { return fn(subCtx) })
+		}
+		return fn(subCtx)
+	}
 	if len(fns) == 1 {
-		return fns[0](subCtx)
+		return callFn(fns[0])
 	}
 
 	var bcast broadcast.Broadcast
@@ -26,7 +46,7 @@ func CallConcurrently(ctx context.Context, fns ...CallConcurrentlyFunc) error {
 	var exitErr error
 
 	callFunc := func(fn CallConcurrentlyFunc) {
-		err := fn(subCtx)
+		err := callFn(fn)
 		bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
 			running--
 			if err != nil && (exitErr == nil || exitErr == context.Canceled) {
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"sync/atomic"
 	"testing"
+
+	"github.com/aperturerobotics/util/panics"
 )
 
 // TestCallConcurrently_Success tests calling multiple functions concurrently successfully.
@@ -47,3 +49,22 @@ func TestCallConcurrently_Err(t *testing.T) {
 		t.Fatalf("expected error but got %v", err)
 	}
 }
+
+// TestCallConcurrentlyRecover tests recovering a panic in a function.
+func TestCallConcurrentlyRecover(t *testing.T) {
+	fns := []CallConcurrentlyFunc{
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			return context.Canceled
+		},
+		func(ctx context.Context) error {
+			panic("test panic")
+		},
+	}
+
+	err := CallConcurrentlyRecover(context.Background(), fns...)
+	var perr *panics.PanicError
+	if !errors.As(err, &perr) || perr.Value != "test panic" {
+		t.Fatalf("expected panic error but got %v", err)
+	}
+}
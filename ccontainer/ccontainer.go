@@ -12,6 +12,10 @@ type CContainer[T comparable] struct {
 	bcast broadcast.Broadcast
 	val   T
 	equal func(a, b T) bool
+	// version is incremented each time the value changes
+	version uint64
+	// setHooks are called with each new value while bcast is locked
+	setHooks []*setHook[T]
 }
 
 // NewCContainer builds a CContainer with an initial value.
@@ -38,12 +42,21 @@ func (c *CContainer[T]) GetValue() T {
 	return val
 }
 
+// GetValueWithVersion returns the immediate value of the container and its version.
+//
+// The version starts at zero and is incremented each time the value changes.
+func (c *CContainer[T]) GetValueWithVersion() (T, uint64) {
+	locked := c.bcast.Lock()
+	val, version := c.val, c.version
+	locked.Unlock()
+	return val, version
+}
+
 // SetValue sets the ccontainer value.
 func (c *CContainer[T]) SetValue(val T) {
 	c.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
 		if !c.compare(c.val, val) {
-			c.val = val
-			broadcast()
+			c.setValueLocked(val, broadcast)
 		}
 	})
 }
@@ -59,8 +72,7 @@ func (c *CContainer[T]) SwapValue(cb func(val T) T) T {
 		if cb != nil {
 			val = cb(val)
 			if !c.compare(c.val, val) {
-				c.val = val
-				broadcast()
+				c.setValueLocked(val, broadcast)
 			}
 		}
 	})
@@ -132,6 +144,43 @@ func (c *CContainer[T]) WaitValueChange(ctx context.Context, old T, errCh <-chan
 	}, errCh)
 }
 
+// WaitVersionChange waits for the version to differ from the given version.
+//
+// Returns the current value and version, which may be several versions ahead.
+// Unlike WaitValueChange, a change from A to B and back to A is observed.
+// errCh is an optional channel to read an error from.
+func (c *CContainer[T]) WaitVersionChange(ctx context.Context, version uint64, errCh <-chan error) (T, uint64, error) {
+	var emptyValue T
+	for {
+		locked := c.bcast.Lock()
+		val, nextVersion := c.val, c.version
+		var wake <-chan struct{}
+		if nextVersion == version {
+			wake = locked.WaitCh()
+		}
+		locked.Unlock()
+		if wake == nil {
+			return val, nextVersion, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return emptyValue, 0, ctx.Err()
+		case err, ok := <-errCh:
+			if !ok {
+				// errCh was non-nil but was closed
+				// treat this as context canceled
+				return emptyValue, 0, context.Canceled
+			}
+			if err != nil {
+				return emptyValue, 0, err
+			}
+		case <-wake:
+			// woken, value changed
+		}
+	}
+}
+
 // WaitValueEmpty waits for an empty value.
 // errCh is an optional channel to read an error from.
 func (c *CContainer[T]) WaitValueEmpty(ctx context.Context, errCh <-chan error) error {
@@ -142,6 +191,17 @@ func (c *CContainer[T]) WaitValueEmpty(ctx context.Context, errCh <-chan error)
 	return err
 }
 
+// setValueLocked stores a changed value and wakes waiters.
+// expects bcast to be locked by caller
+func (c *CContainer[T]) setValueLocked(val T, broadcast func()) {
+	c.val = val
+	c.version++
+	for _, hook := range c.setHooks {
+		hook.cb(val)
+	}
+	broadcast()
+}
+
 // compare checks of two values are equal
 func (c *CContainer[T]) compare(a, b T) bool {
 	if a == b {
@@ -154,4 +214,4 @@ func (c *CContainer[T]) compare(a, b T) bool {
 }
 
 // _ is a type assertion
-var _ Watchable[struct{}] = ((*CContainer[struct{}])(nil))
+var _ VersionedWatchable[struct{}] = ((*CContainer[struct{}])(nil))
@@ -110,3 +110,79 @@ func TestCContainerWithEqual(t *testing.T) {
 	c.SetValue(&data{value: "different"})
 	assertDone()
 }
+
+// TestCContainerVersion tests observing changes by version.
+func TestCContainerVersion(t *testing.T) {
+	ctx := context.Background()
+	c := NewCContainer("a")
+	_, version := c.GetValueWithVersion()
+	if version != 0 {
+		t.Fatalf("expected version 0, got %d", version)
+	}
+
+	// equal values do not bump the version
+	c.SetValue("a")
+	if _, v := c.GetValueWithVersion(); v != 0 {
+		t.Fatalf("expected version 0, got %d", v)
+	}
+
+	// a -> b -> a is observed as a change
+	c.SetValue("b")
+	c.SwapValue(func(string) string { return "a" })
+	val, nextVersion, err := c.WaitVersionChange(ctx, version, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val != "a" || nextVersion != 2 {
+		t.Fatalf("expected a@2, got %s@%d", val, nextVersion)
+	}
+
+	dl, dlCancel := context.WithDeadline(ctx, time.Now().Add(time.Millisecond*1))
+	defer dlCancel()
+	if _, _, err := c.WaitVersionChange(dl, nextVersion, nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestWatchVersionChanges tests reporting skipped versions.
+func TestWatchVersionChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewCContainer(0)
+	for i := 1; i <= 3; i++ {
+		c.SetValue(i)
+	}
+
+	var seen, skipped uint64
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WatchVersionChanges(ctx, 0, c, func(val int, version, skip uint64) error {
+			seen++
+			skipped += skip
+			if version == 5 {
+				cancel()
+			}
+			return nil
+		}, nil)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	c.SetValue(4)
+	c.SetValue(5)
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WatchVersionChanges did not return")
+	}
+	if seen+skipped != 5 {
+		t.Fatalf("expected 5 versions seen or skipped, got %d seen and %d skipped", seen, skipped)
+	}
+	if skipped < 2 {
+		t.Fatalf("expected at least 2 skipped versions, got %d", skipped)
+	}
+}
@@ -0,0 +1,417 @@
+package ccontainer
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/aperturerobotics/util/broadcast"
+)
+
+// Map returns a Watchable with the result of fn applied to the value of w.
+//
+// The derived value is computed on demand: no goroutine or container is
+// allocated per derived value. Waiters are only woken when the mapped result
+// changes according to ==.
+func Map[T, U comparable](w Watchable[T], fn func(v T) U) Watchable[U] {
+	return MapWithEqual(w, fn, nil)
+}
+
+// MapWithEqual is Map with a comparator for the mapped result.
+//
+// isEqual is an optional comparator, for example proto.CompareEqualVT. Waiters
+// are not woken when the result is equal to the previous result.
+func MapWithEqual[T, U comparable](w Watchable[T], fn func(v T) U, isEqual func(a, b U) bool) Watchable[U] {
+	return &derived[U]{
+		equal: isEqual,
+		addHook: func(cb func(val U)) (func(), bool) {
+			return addSetHook(w, func(val T) {
+				cb(fn(val))
+			})
+		},
+		get: func() U {
+			return fn(w.GetValue())
+		},
+		snapshot: func(ctx context.Context, waitChs []<-chan struct{}) (U, []<-chan struct{}) {
+			val, waitChs := getValueWaitChs(ctx, w, waitChs)
+			return fn(val), waitChs
+		},
+	}
+}
+
+// Combine returns a Watchable with the result of fn applied to the values of a
+// and b, recomputed whenever either input changes.
+//
+// Waiters are only woken when the combined result changes according to ==.
+func Combine[A, B, C comparable](a Watchable[A], b Watchable[B], fn func(a A, b B) C) Watchable[C] {
+	return CombineWithEqual(a, b, fn, nil)
+}
+
+// CombineWithEqual is Combine with a comparator for the combined result.
+//
+// isEqual is an optional comparator, for example proto.CompareEqualVT.
+func CombineWithEqual[A, B, C comparable](
+	a Watchable[A],
+	b Watchable[B],
+	fn func(a A, b B) C,
+	isEqual func(a, b C) bool,
+) Watchable[C] {
+	return &derived[C]{
+		equal: isEqual,
+		addHook: func(cb func(val C)) (func(), bool) {
+			// mtx guards the latest values of a and b
+			var mtx sync.Mutex
+			var aVal A
+			var bVal B
+			var hasA, hasB bool
+			removeA, ok := addSetHook(a, func(val A) {
+				mtx.Lock()
+				aVal, hasA = val, true
+				if hasB {
+					cb(fn(aVal, bVal))
+				}
+				mtx.Unlock()
+			})
+			if !ok {
+				return nil, false
+			}
+			removeB, ok := addSetHook(b, func(val B) {
+				mtx.Lock()
+				bVal, hasB = val, true
+				if hasA {
+					cb(fn(aVal, bVal))
+				}
+				mtx.Unlock()
+			})
+			if !ok {
+				removeA()
+				return nil, false
+			}
+			return func() {
+				removeA()
+				removeB()
+			}, true
+		},
+		get: func() C {
+			return fn(a.GetValue(), b.GetValue())
+		},
+		snapshot: func(ctx context.Context, waitChs []<-chan struct{}) (C, []<-chan struct{}) {
+			aVal, waitChs := getValueWaitChs(ctx, a, waitChs)
+			bVal, waitChs := getValueWaitChs(ctx, b, waitChs)
+			return fn(aVal, bVal), waitChs
+		},
+	}
+}
+
+// Filter returns a Watchable holding the last value of w that passed pred.
+//
+// If w is a CContainer or is derived from containers with Map or Combine,
+// every value is checked when it is set, so the held value is the last value
+// that passed even if nobody read it before it was replaced. pred is then
+// called while the source containers are locked and must not call methods on
+// them. The check is unregistered when the returned Watchable is garbage
+// collected. Other watchables are checked only when the value is read.
+//
+// The value is the zero value until a value passes. Waiters are only woken
+// when the held value changes according to ==.
+func Filter[T comparable](w Watchable[T], pred func(v T) bool) Watchable[T] {
+	f := &filterState[T]{}
+	remove, ok := addSetHook(w, func(val T) {
+		if pred(val) {
+			f.store(val)
+		}
+	})
+	if !ok {
+		// check the values as they are read
+		return &derived[T]{
+			get: func() T {
+				return f.sample(w.GetValue(), pred)
+			},
+			snapshot: func(ctx context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{}) {
+				val, waitChs := getValueWaitChs(ctx, w, waitChs)
+				return f.sample(val, pred), waitChs
+			},
+		}
+	}
+
+	d := &derived[T]{
+		get:      f.load,
+		snapshot: f.getValueWaitChs,
+	}
+	runtime.AddCleanup(d, func(remove func()) { remove() }, remove)
+	return d
+}
+
+// filterState holds the last value that passed a Filter.
+type filterState[T comparable] struct {
+	// bcast guards held
+	bcast broadcast.Broadcast
+	// held is the last value that passed
+	held T
+}
+
+// store sets the held value and wakes waiters if it changed.
+func (f *filterState[T]) store(val T) {
+	locked := f.bcast.Lock()
+	if f.held != val {
+		f.held = val
+		locked.Broadcast()
+	}
+	locked.Unlock()
+}
+
+// sample stores val if it passes pred and returns the held value.
+func (f *filterState[T]) sample(val T, pred func(v T) bool) T {
+	locked := f.bcast.Lock()
+	if pred(val) {
+		f.held = val
+	}
+	val = f.held
+	locked.Unlock()
+	return val
+}
+
+// load returns the held value.
+func (f *filterState[T]) load() T {
+	locked := f.bcast.Lock()
+	val := f.held
+	locked.Unlock()
+	return val
+}
+
+// getValueWaitChs returns the held value and appends the wait channel.
+func (f *filterState[T]) getValueWaitChs(_ context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{}) {
+	locked := f.bcast.Lock()
+	val := f.held
+	waitChs = append(waitChs, locked.WaitCh())
+	locked.Unlock()
+	return val, waitChs
+}
+
+// setHook is a callback called with each value set on a CContainer.
+type setHook[T comparable] struct {
+	cb func(val T)
+}
+
+// setHookWatchable is implemented by watchables that can call a hook with
+// every value that is set.
+type setHookWatchable[T comparable] interface {
+	// addSetHook calls cb with the current value and then with each new value.
+	// Returns a func to remove the hook and false if hooks are not supported.
+	addSetHook(cb func(val T)) (remove func(), ok bool)
+}
+
+// addSetHook adds a set hook to w if supported.
+func addSetHook[T comparable](w Watchable[T], cb func(val T)) (func(), bool) {
+	if hw, ok := w.(setHookWatchable[T]); ok {
+		return hw.addSetHook(cb)
+	}
+	return nil, false
+}
+
+// addSetHook calls cb with the current value and then with each new value.
+func (c *CContainer[T]) addSetHook(cb func(val T)) (func(), bool) {
+	hook := &setHook[T]{cb: cb}
+	locked := c.bcast.Lock()
+	c.setHooks = append(c.setHooks, hook)
+	cb(c.val)
+	locked.Unlock()
+	return func() {
+		locked := c.bcast.Lock()
+		c.setHooks = slices.DeleteFunc(c.setHooks, func(h *setHook[T]) bool {
+			return h == hook
+		})
+		locked.Unlock()
+	}, true
+}
+
+// waitChWatchable is implemented by watchables that expose wait channels.
+type waitChWatchable[T comparable] interface {
+	// getValueWaitChs returns the current value and appends wait channels that
+	// are closed when the value may have changed.
+	getValueWaitChs(ctx context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{})
+}
+
+// getValueWaitChs returns the value of w and appends a channel that is closed
+// when the value may have changed.
+//
+// Watchables that do not expose their wait channels are watched with a
+// goroutine until ctx is canceled.
+func getValueWaitChs[T comparable](ctx context.Context, w Watchable[T], waitChs []<-chan struct{}) (T, []<-chan struct{}) {
+	if ww, ok := w.(waitChWatchable[T]); ok {
+		return ww.getValueWaitChs(ctx, waitChs)
+	}
+	val := w.GetValue()
+	ch := make(chan struct{})
+	go func() {
+		_, _ = w.WaitValueChange(ctx, val, nil)
+		close(ch)
+	}()
+	return val, append(waitChs, ch)
+}
+
+// getValueWaitChs returns the current value and appends the wait channel.
+func (c *CContainer[T]) getValueWaitChs(_ context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{}) {
+	locked := c.bcast.Lock()
+	val := c.val
+	waitChs = append(waitChs, locked.WaitCh())
+	locked.Unlock()
+	return val, waitChs
+}
+
+// derived is a Watchable computed from other watchables.
+type derived[T comparable] struct {
+	// get computes the current value
+	get func() T
+	// snapshot computes the current value and appends the source wait channels
+	snapshot func(ctx context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{})
+	// equal is an optional comparator
+	equal func(a, b T) bool
+	// addHook adds a set hook to the sources, if supported
+	addHook func(cb func(val T)) (func(), bool)
+}
+
+// GetValue returns the current value.
+func (d *derived[T]) GetValue() T {
+	return d.get()
+}
+
+// WaitValueWithValidator waits for any value that matches the validator.
+// errCh is an optional channel to read an error from.
+func (d *derived[T]) WaitValueWithValidator(
+	ctx context.Context,
+	valid func(v T) (bool, error),
+	errCh <-chan error,
+) (T, error) {
+	var emptyValue T
+	var waitChs []<-chan struct{}
+	for {
+		waitCtx, waitCancel := context.WithCancel(ctx)
+		var val T
+		val, waitChs = d.snapshot(waitCtx, waitChs[:0])
+
+		var ok bool
+		var err error
+		if valid != nil {
+			ok, err = valid(val)
+		} else {
+			ok = !d.compare(val, emptyValue)
+		}
+		if err == nil && !ok {
+			err = waitDerived(ctx, errCh, waitChs)
+		}
+		waitCancel()
+		if err != nil {
+			return emptyValue, err
+		}
+		if ok {
+			return val, nil
+		}
+	}
+}
+
+// WaitValue waits for any non-nil value.
+// errCh is an optional channel to read an error from.
+func (d *derived[T]) WaitValue(ctx context.Context, errCh <-chan error) (T, error) {
+	return d.WaitValueWithValidator(ctx, nil, errCh)
+}
+
+// WaitValueChange waits for a value that is different than the given.
+// errCh is an optional channel to read an error from.
+func (d *derived[T]) WaitValueChange(ctx context.Context, old T, errCh <-chan error) (T, error) {
+	return d.WaitValueWithValidator(ctx, func(v T) (bool, error) {
+		return !d.compare(old, v), nil
+	}, errCh)
+}
+
+// WaitValueEmpty waits for an empty value.
+// errCh is an optional channel to read an error from.
+func (d *derived[T]) WaitValueEmpty(ctx context.Context, errCh <-chan error) error {
+	_, err := d.WaitValueWithValidator(ctx, func(v T) (bool, error) {
+		var emptyValue T
+		return d.compare(emptyValue, v), nil
+	}, errCh)
+	return err
+}
+
+// getValueWaitChs returns the current value and appends the source wait channels.
+func (d *derived[T]) getValueWaitChs(ctx context.Context, waitChs []<-chan struct{}) (T, []<-chan struct{}) {
+	return d.snapshot(ctx, waitChs)
+}
+
+// addSetHook calls cb with the current value and then with each new value.
+func (d *derived[T]) addSetHook(cb func(val T)) (func(), bool) {
+	if d.addHook == nil {
+		return nil, false
+	}
+	return d.addHook(cb)
+}
+
+// compare checks of two values are equal
+func (d *derived[T]) compare(a, b T) bool {
+	if a == b {
+		return true
+	}
+	if d.equal != nil && d.equal(a, b) {
+		return true
+	}
+	return false
+}
+
+// waitDerived waits for ctx, errCh, or any of the wait channels.
+//
+// Returns nil if a wait channel was closed.
+func waitDerived(ctx context.Context, errCh <-chan error, waitChs []<-chan struct{}) error {
+	if len(waitChs) == 1 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-errCh:
+			return errChResult(err, ok)
+		case <-waitChs[0]:
+			return nil
+		}
+	}
+
+	cases := make([]reflect.SelectCase, 2, len(waitChs)+2)
+	cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+	cases[1] = reflect.SelectCase{Dir: reflect.SelectRecv}
+	if errCh != nil {
+		cases[1].Chan = reflect.ValueOf(errCh)
+	}
+	for _, ch := range waitChs {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	switch chosen, recv, ok := reflect.Select(cases); chosen {
+	case 0:
+		return ctx.Err()
+	case 1:
+		var err error
+		if ok && !recv.IsNil() {
+			err = recv.Interface().(error)
+		}
+		return errChResult(err, ok)
+	default:
+		return nil
+	}
+}
+
+// errChResult converts a value received from errCh to the wait result.
+func errChResult(err error, ok bool) error {
+	if !ok {
+		// errCh was non-nil but was closed
+		// treat this as context canceled
+		return context.Canceled
+	}
+	return err
+}
+
+// _ is a type assertion
+var (
+	_ Watchable[struct{}]        = ((*derived[struct{}])(nil))
+	_ waitChWatchable[struct{}]  = ((*CContainer[struct{}])(nil))
+	_ setHookWatchable[struct{}] = ((*CContainer[struct{}])(nil))
+	_ setHookWatchable[struct{}] = ((*derived[struct{}])(nil))
+)
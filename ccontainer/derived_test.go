@@ -0,0 +1,223 @@
+package ccontainer
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestMap tests that a mapped watchable only wakes on result changes.
+func TestMap(t *testing.T) {
+	ctx := t.Context()
+	c := NewCContainer(0)
+	parity := Map(c, func(v int) bool { return v%2 == 1 })
+
+	done := make(chan bool, 1)
+	go func() {
+		val, err := parity.WaitValueChange(ctx, false, nil)
+		if err != nil {
+			t.Error(err.Error())
+		}
+		done <- val
+	}()
+
+	c.SetValue(2)
+	select {
+	case <-done:
+		t.Fatal("waiter woke on unchanged result")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.SetValue(3)
+	select {
+	case val := <-done:
+		if !val {
+			t.Fatal("expected true")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter did not wake on changed result")
+	}
+	if !parity.GetValue() {
+		t.Fatal("expected GetValue to return true")
+	}
+}
+
+// TestMapWithEqual tests the mapped result comparator.
+func TestMapWithEqual(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	c := NewCContainer(1)
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	w := MapWithEqual(c, func(v int) int { return v }, func(a, b int) bool {
+		return abs(a) == abs(b)
+	})
+	c.SetValue(-1)
+	if _, err := w.WaitValueChange(ctx, 1, nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestCombine tests combining two containers.
+func TestCombine(t *testing.T) {
+	ctx := t.Context()
+	connected := NewCContainer(false)
+	configured := NewCContainer(false)
+	ready := Combine(connected, configured, func(a, b bool) bool { return a && b })
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ready.WaitValueWithValidator(ctx, func(v bool) (bool, error) {
+			return v, nil
+		}, nil)
+		done <- err
+	}()
+
+	configured.SetValue(true)
+	select {
+	case err := <-done:
+		t.Fatalf("ready before connected: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	connected.SetValue(true)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("combined value did not update")
+	}
+
+	// derived watchables compose
+	label := Map(ready, func(v bool) string {
+		if v {
+			return "ready"
+		}
+		return "waiting"
+	})
+	if val := label.GetValue(); val != "ready" {
+		t.Fatalf("expected ready, got %s", val)
+	}
+}
+
+// TestFilter tests holding the last value that passed the predicate.
+func TestFilter(t *testing.T) {
+	ctx := t.Context()
+	c := NewCContainer(2)
+	even := Filter(c, func(v int) bool { return v%2 == 0 })
+
+	c.SetValue(3)
+	if val := even.GetValue(); val != 2 {
+		t.Fatalf("expected 2, got %d", val)
+	}
+
+	go func() {
+		c.SetValue(5)
+		c.SetValue(4)
+	}()
+	val, err := even.WaitValueChange(ctx, 2, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val != 4 {
+		t.Fatalf("expected 4, got %d", val)
+	}
+}
+
+// TestFilterUnobserved tests that values are held even if nobody read them.
+func TestFilterUnobserved(t *testing.T) {
+	c := NewCContainer(0)
+	positive := Filter(c, func(v int) bool { return v > 0 })
+
+	c.SetValue(5)
+	c.SetValue(-1)
+	if val := positive.GetValue(); val != 5 {
+		t.Fatalf("expected 5, got %d", val)
+	}
+	c.SwapValue(func(int) int { return 7 })
+	c.SetValue(-2)
+	if val := positive.GetValue(); val != 7 {
+		t.Fatalf("expected 7, got %d", val)
+	}
+}
+
+// TestFilterDerived tests filtering the output of Map and Combine.
+func TestFilterDerived(t *testing.T) {
+	c := NewCContainer(1)
+	other := NewCContainer(10)
+	doubled := Filter(Map(c, func(v int) int { return v * 2 }), func(v int) bool { return v > 4 })
+	sum := Filter(Combine(c, other, func(a, b int) int { return a + b }), func(v int) bool { return v%2 == 0 })
+
+	c.SetValue(3)
+	c.SetValue(1)
+	if val := doubled.GetValue(); val != 6 {
+		t.Fatalf("expected 6, got %d", val)
+	}
+	// 1+11 passes, 1+12 fails
+	other.SetValue(11)
+	other.SetValue(12)
+	if val := sum.GetValue(); val != 12 {
+		t.Fatalf("expected 12, got %d", val)
+	}
+	c.SetValue(2)
+	if val := sum.GetValue(); val != 14 {
+		t.Fatalf("expected 14, got %d", val)
+	}
+}
+
+// TestFilterRelease tests that the filter is unregistered when dropped.
+func TestFilterRelease(t *testing.T) {
+	c := NewCContainer(0)
+	func() {
+		_ = Filter(Map(c, func(v int) int { return v }), func(v int) bool { return v > 0 })
+	}()
+	for range 100 {
+		runtime.GC()
+		locked := c.bcast.Lock()
+		n := len(c.setHooks)
+		locked.Unlock()
+		if n == 0 {
+			return
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+	t.Fatal("expected filter hook to be removed")
+}
+
+// opaqueWatchable hides the wait channels of the wrapped Watchable.
+type opaqueWatchable[T comparable] struct {
+	Watchable[T]
+}
+
+// TestCombineOpaque tests combining watchables that do not expose wait channels.
+func TestCombineOpaque(t *testing.T) {
+	ctx := t.Context()
+	a := NewCContainer(1)
+	b := NewCContainer(2)
+	sum := Combine[int, int, int](opaqueWatchable[int]{a}, opaqueWatchable[int]{b}, func(a, b int) int {
+		return a + b
+	})
+
+	go b.SetValue(5)
+	val, err := sum.WaitValueChange(ctx, 3, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val != 6 {
+		t.Fatalf("expected 6, got %d", val)
+	}
+
+	errCh := make(chan error, 1)
+	close(errCh)
+	if _, err := sum.WaitValueChange(ctx, 6, errCh); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
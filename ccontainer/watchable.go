@@ -25,6 +25,20 @@ type Watchable[T comparable] interface {
 	WaitValueEmpty(ctx context.Context, errCh <-chan error) error
 }
 
+// VersionedWatchable is a Watchable that keeps a version counter.
+//
+// The version is incremented each time the value changes, so waiters can
+// observe changes that return to a previous value and count skipped changes.
+type VersionedWatchable[T comparable] interface {
+	Watchable[T]
+
+	// GetValueWithVersion returns the current value and version.
+	GetValueWithVersion() (T, uint64)
+	// WaitVersionChange waits for the version to differ from the given version.
+	// errCh is an optional channel to read an error from.
+	WaitVersionChange(ctx context.Context, version uint64, errCh <-chan error) (T, uint64, error)
+}
+
 // ToWatchable converts a ccontainer to a Watchable (somewhat read-only).
 func ToWatchable[T comparable](ctr *CContainer[T]) Watchable[T] {
 	return ctr
@@ -36,6 +50,11 @@ func ToWatchable[T comparable](ctr *CContainer[T]) Watchable[T] {
 // initial is the initial value to wait for changes on.
 // set initial to nil to wait for value != nil.
 //
+// Changes are detected by comparing values, so a value that changes and
+// returns to the previous value between wakeups is not reported. Use
+// WatchVersionChanges with a VersionedWatchable to observe every change and
+// the number of skipped versions.
+//
 // T is the type of the message.
 // errCh is an optional error channel to interrupt the operation.
 func WatchChanges[T comparable](
@@ -59,3 +78,33 @@ func WatchChanges[T comparable](
 		}
 	}
 }
+
+// WatchVersionChanges watches a VersionedWatchable and calls the callback each
+// time the version changes.
+//
+// version is the version to wait for changes from, usually from
+// GetValueWithVersion. skipped is the number of versions that were replaced
+// before they could be observed since the previous call, which is zero if
+// every change was observed.
+//
+// errCh is an optional error channel to interrupt the operation.
+func WatchVersionChanges[T comparable](
+	ctx context.Context,
+	version uint64,
+	ctr VersionedWatchable[T],
+	updateCb func(msg T, version, skipped uint64) error,
+	errCh <-chan error,
+) error {
+	for {
+		next, nextVersion, err := ctr.WaitVersionChange(ctx, version, errCh)
+		if err != nil {
+			return err
+		}
+
+		skipped := nextVersion - version - 1
+		version = nextVersion
+		if err := updateCb(next, nextVersion, skipped); err != nil {
+			return err
+		}
+	}
+}
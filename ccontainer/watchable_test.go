@@ -3,6 +3,7 @@ package ccontainer
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 // TestWatchable tests the watchable ccontainer
@@ -24,3 +25,46 @@ func TestWatchable(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// TestWatchVersionChangesABA tests that a value which changes and returns to
+// the previous value is observed with the number of skipped versions.
+func TestWatchVersionChangesABA(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewCContainer("a")
+	_, version := c.GetValueWithVersion()
+
+	// change to b and back to a before anything observes b
+	c.SetValue("b")
+	c.SetValue("a")
+
+	val, nextVersion, err := c.WaitVersionChange(ctx, version, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val != "a" || nextVersion != version+2 {
+		t.Fatalf("expected a at version %d, got %s at version %d", version+2, val, nextVersion)
+	}
+
+	type update struct {
+		msg     string
+		version uint64
+		skipped uint64
+	}
+	updates := make(chan update, 4)
+	go func() {
+		_ = WatchVersionChanges(ctx, version, c, func(msg string, version, skipped uint64) error {
+			updates <- update{msg: msg, version: version, skipped: skipped}
+			return nil
+		}, nil)
+	}()
+	select {
+	case u := <-updates:
+		if u.msg != "a" || u.version != version+2 || u.skipped != 1 {
+			t.Fatalf("expected a at version %d with 1 skipped, got %v", version+2, u)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WatchVersionChanges missed the a -> b -> a change")
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/aperturerobotics/util/broadcast"
 	"github.com/aperturerobotics/util/linkedlist"
+	"github.com/aperturerobotics/util/panics"
 )
 
 // ConcurrentQueue is a pool of goroutines processing a stream of jobs.
@@ -20,16 +21,43 @@ type ConcurrentQueue struct {
 	jobQueue *linkedlist.LinkedList[func()]
 	// jobQueueSize is the current size of jobQueue
 	jobQueueSize int
+	// recoverPanics indicates panics in jobs are recovered
+	recoverPanics bool
+	// onPanic is called with recovered panics, if set
+	onPanic func(err *panics.PanicError)
 }
 
 // NewConcurrentQueue constructs a new stream concurrency manager.
 // initialElems contains the initial set of queued entries.
 // if maxConcurrency <= 0, spawns infinite goroutines.
 func NewConcurrentQueue(maxConcurrency int, initialElems ...func()) *ConcurrentQueue {
+	return newConcurrentQueue(maxConcurrency, false, nil, initialElems)
+}
+
+// NewConcurrentQueueWithPanicHandler constructs a new stream concurrency manager
+// which recovers panics in jobs.
+//
+// onPanic is called with each recovered panic, if set.
+// Calls the global hook set with panics.SetHook.
+// initialElems contains the initial set of queued entries.
+// if maxConcurrency <= 0, spawns infinite goroutines.
+func NewConcurrentQueueWithPanicHandler(maxConcurrency int, onPanic func(err *panics.PanicError), initialElems ...func()) *ConcurrentQueue {
+	return newConcurrentQueue(maxConcurrency, true, onPanic, initialElems)
+}
+
+// newConcurrentQueue constructs a new ConcurrentQueue and starts the initial jobs.
+func newConcurrentQueue(
+	maxConcurrency int,
+	recoverPanics bool,
+	onPanic func(err *panics.PanicError),
+	initialElems []func(),
+) *ConcurrentQueue {
 	str := &ConcurrentQueue{
 		jobQueue:       linkedlist.NewLinkedList(initialElems...),
 		jobQueueSize:   len(initialElems),
 		maxConcurrency: maxConcurrency,
+		recoverPanics:  recoverPanics,
+		onPanic:        onPanic,
 	}
 	if len(initialElems) != 0 {
 		str.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
@@ -155,7 +183,7 @@ func (s *ConcurrentQueue) updateLocked(broadcast func()) {
 func (s *ConcurrentQueue) executeJob(job func()) {
 	for {
 		if job != nil {
-			job()
+			s.callJob(job)
 		}
 
 		var jobOk bool
@@ -173,3 +201,18 @@ func (s *ConcurrentQueue) executeJob(job func()) {
 		}
 	}
 }
+
+// callJob calls the job function, recovering panics if enabled.
+func (s *ConcurrentQueue) callJob(job func()) {
+	if !s.recoverPanics {
+		job()
+		return
+	}
+	err := panics.Call(func() error {
+		job()
+		return nil
+	})
+	if perr, ok := err.(*panics.PanicError); ok && s.onPanic != nil {
+		s.onPanic(perr)
+	}
+}
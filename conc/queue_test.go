@@ -1,7 +1,10 @@
 package conc
 
 import (
+	"context"
 	"testing"
+
+	"github.com/aperturerobotics/util/panics"
 )
 
 // TestConcurrentQueue tests the concurrent queue type.
@@ -44,3 +47,26 @@ func TestConcurrentQueue(t *testing.T) {
 	<-jobs[3]
 	<-jobs[4]
 }
+
+// TestConcurrentQueue_PanicHandler tests recovering panics in jobs.
+func TestConcurrentQueue_PanicHandler(t *testing.T) {
+	panicErrs := make(chan *panics.PanicError, 1)
+	done := make(chan struct{})
+	q := NewConcurrentQueueWithPanicHandler(1, func(err *panics.PanicError) {
+		panicErrs <- err
+	})
+	q.Enqueue(func() {
+		panic("test panic")
+	}, func() {
+		close(done)
+	})
+
+	// expect the queue to continue with the next job
+	<-done
+	if err := <-panicErrs; err.Value != "test panic" {
+		t.Fatalf("unexpected panic value: %v", err.Value)
+	}
+	if err := q.WaitIdle(context.Background(), nil); err != nil {
+		t.Fatal(err.Error())
+	}
+}
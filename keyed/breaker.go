@@ -0,0 +1,169 @@
+package keyed
+
+import (
+	"time"
+)
+
+// BreakerState is the state of a per-key circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed indicates the routine runs and retries normally.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen indicates the routine failed too often and is parked until
+	// the cooldown has passed.
+	BreakerOpen
+	// BreakerHalfOpen indicates the cooldown passed and a single probe run is
+	// allowed. If the probe fails the breaker opens again.
+	BreakerHalfOpen
+)
+
+// String returns the name of the breaker state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerConfig is the circuit breaker configuration.
+type breakerConfig struct {
+	// maxFailures is the number of failures within window to open the breaker.
+	maxFailures int
+	// window is the window to count failures within.
+	window time.Duration
+	// cooldown is the time to wait before allowing a probe run.
+	cooldown time.Duration
+}
+
+// circuitBreaker is the circuit breaker state for a routine.
+type circuitBreaker struct {
+	// state is the current breaker state
+	state BreakerState
+	// failures contains the times of failures within the window
+	failures []time.Time
+	// openUntil is when the breaker will become half-open
+	openUntil time.Time
+	// cooldownTimer is set while the breaker is open
+	cooldownTimer *time.Timer
+}
+
+// ResetCircuitBreaker closes the circuit breaker for the given key.
+//
+// Clears the failure history. If the breaker was open, the routine is
+// restarted immediately. Returns false if the key does not exist or the
+// circuit breaker is not enabled.
+func (k *Keyed[K, V]) ResetCircuitBreaker(key K) bool {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	v, existed := k.routines[key]
+	if !existed || v.breaker == nil {
+		return false
+	}
+
+	wasOpen := v.breaker.state == BreakerOpen
+	v.closeBreakerLocked()
+	if wasOpen && k.ctx != nil && v.exited {
+		v.start(k.ctx, v.exitedCh, true)
+	}
+	return true
+}
+
+// recordBreakerExitLocked records an exit of the routine with the circuit breaker.
+// Returns true if the breaker is now open and the routine should not be retried.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) recordBreakerExitLocked(err error) bool {
+	b, conf := r.breaker, r.k.breakerConf
+	now := time.Now()
+	if b.state == BreakerHalfOpen {
+		if err != nil && now.Sub(r.lastStarted) < conf.window {
+			// probe failed
+			r.openBreakerLocked(now, err)
+			return true
+		}
+		r.closeBreakerLocked()
+	}
+	if err == nil {
+		return false
+	}
+
+	// prune failures outside of the window
+	failures := b.failures[:0]
+	for _, t := range b.failures {
+		if now.Sub(t) < conf.window {
+			failures = append(failures, t)
+		}
+	}
+	b.failures = append(failures, now)
+	if len(b.failures) >= conf.maxFailures {
+		r.openBreakerLocked(now, err)
+		return true
+	}
+	return false
+}
+
+// openBreakerLocked opens the circuit breaker parking the routine until the cooldown.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) openBreakerLocked(now time.Time, err error) {
+	b, cooldown := r.breaker, r.k.breakerConf.cooldown
+	if r.deferRetry != nil {
+		_ = r.deferRetry.Stop()
+		r.deferRetry = nil
+	}
+	if b.cooldownTimer != nil {
+		_ = b.cooldownTimer.Stop()
+	}
+	b.state = BreakerOpen
+	b.failures = nil
+	b.openUntil = now.Add(cooldown)
+
+	var cooldownTimer *time.Timer
+	cooldownTimer = time.AfterFunc(cooldown, func() {
+		r.k.mtx.Lock()
+		defer r.k.mtx.Unlock()
+		if b.cooldownTimer != cooldownTimer {
+			return
+		}
+		b.cooldownTimer = nil
+		b.state = BreakerHalfOpen
+		b.openUntil = time.Time{}
+		r.k.emitLocked(EventBreakerHalfOpen, r.key, nil, 0)
+		if r.k.ctx != nil && r.k.routines[r.key] == r && r.exited && r.k.ctx.Err() == nil {
+			r.start(r.k.ctx, r.exitedCh, true)
+		}
+	})
+	b.cooldownTimer = cooldownTimer
+	r.k.emitLocked(EventBreakerOpen, r.key, err, cooldown)
+}
+
+// closeBreakerLocked closes the circuit breaker and clears the failure history.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) closeBreakerLocked() {
+	b := r.breaker
+	if b.cooldownTimer != nil {
+		_ = b.cooldownTimer.Stop()
+		b.cooldownTimer = nil
+	}
+	b.failures = nil
+	b.openUntil = time.Time{}
+	if b.state != BreakerClosed {
+		b.state = BreakerClosed
+		r.k.emitLocked(EventBreakerClosed, r.key, nil, 0)
+	}
+}
+
+// stopBreakerLocked stops the cooldown timer, if any.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) stopBreakerLocked() {
+	if r.breaker != nil && r.breaker.cooldownTimer != nil {
+		_ = r.breaker.cooldownTimer.Stop()
+		r.breaker.cooldownTimer = nil
+	}
+}
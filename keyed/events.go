@@ -0,0 +1,140 @@
+package keyed
+
+import "time"
+
+// EventKind is the kind of a key lifecycle event.
+type EventKind int
+
+const (
+	// EventAdded is emitted when a key is added to the set.
+	EventAdded EventKind = iota
+	// EventQueued is emitted when a routine waits for a concurrency slot.
+	EventQueued
+	// EventStarted is emitted when a routine is started.
+	EventStarted
+	// EventReady is emitted when a routine reports it is ready.
+	// Routines which are not a ReadyRoutine are ready once started.
+	EventReady
+	// EventExited is emitted when a routine exits.
+	// Err contains the error returned by the routine, if any.
+	EventExited
+	// EventBackoff is emitted when a routine is waiting to retry after an error.
+	// Err contains the error and Delay contains the backoff duration.
+	EventBackoff
+	// EventRetry is emitted when a routine is restarted after a retry backoff.
+	EventRetry
+	// EventRestarted is emitted when a routine is restarted by RestartRoutine.
+	EventRestarted
+	// EventReset is emitted when a routine is reset by ResetRoutine.
+	EventReset
+	// EventRemoved is emitted when a key is removed from the set.
+	// If a release delay is set, this is emitted after the delay.
+	EventRemoved
+	// EventBreakerOpen is emitted when the circuit breaker for a key opens.
+	// Err contains the last error and Delay contains the cooldown duration.
+	EventBreakerOpen
+	// EventBreakerHalfOpen is emitted when the circuit breaker cooldown passed.
+	EventBreakerHalfOpen
+	// EventBreakerClosed is emitted when the circuit breaker for a key closes.
+	EventBreakerClosed
+)
+
+// String returns the name of the event kind.
+func (e EventKind) String() string {
+	switch e {
+	case EventAdded:
+		return "added"
+	case EventQueued:
+		return "queued"
+	case EventStarted:
+		return "started"
+	case EventReady:
+		return "ready"
+	case EventExited:
+		return "exited"
+	case EventBackoff:
+		return "backoff"
+	case EventRetry:
+		return "retry"
+	case EventRestarted:
+		return "restarted"
+	case EventReset:
+		return "reset"
+	case EventRemoved:
+		return "removed"
+	case EventBreakerOpen:
+		return "breaker-open"
+	case EventBreakerHalfOpen:
+		return "breaker-half-open"
+	case EventBreakerClosed:
+		return "breaker-closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a key lifecycle event.
+type Event[K comparable] struct {
+	// Kind is the kind of event.
+	Kind EventKind
+	// Key is the key the event is for.
+	Key K
+	// Seq is the sequence number of the event.
+	// Incremented by one for each event emitted by the Keyed.
+	Seq uint64
+	// Err is the error associated with the event, if any.
+	Err error
+	// Delay is the retry delay for EventBackoff or cooldown for EventBreakerOpen.
+	Delay time.Duration
+}
+
+// eventSub is an event subscription.
+type eventSub[K comparable] struct {
+	cb func(ev Event[K])
+}
+
+// SubscribeEvents adds a callback for key lifecycle events.
+//
+// Events are delivered in order of Seq. The callback is called with the Keyed
+// mutex locked: it must not block or call any methods on the Keyed.
+// Returns a function to cancel the subscription.
+func (k *Keyed[K, V]) SubscribeEvents(cb func(ev Event[K])) (cancel func()) {
+	if cb == nil {
+		return func() {}
+	}
+
+	sub := &eventSub[K]{cb: cb}
+	k.mtx.Lock()
+	k.eventSubs = append(k.eventSubs, sub)
+	k.mtx.Unlock()
+
+	return func() {
+		k.mtx.Lock()
+		for i, s := range k.eventSubs {
+			if s == sub {
+				k.eventSubs = append(k.eventSubs[:i], k.eventSubs[i+1:]...)
+				break
+			}
+		}
+		k.mtx.Unlock()
+	}
+}
+
+// emitLocked emits an event to the subscribers.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) emitLocked(kind EventKind, key K, err error, delay time.Duration) {
+	k.eventSeq++
+	if len(k.eventSubs) == 0 {
+		return
+	}
+	ev := Event[K]{
+		Kind:  kind,
+		Key:   key,
+		Seq:   k.eventSeq,
+		Err:   err,
+		Delay: delay,
+	}
+	for _, sub := range k.eventSubs {
+		sub.cb(ev)
+	}
+}
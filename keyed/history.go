@@ -0,0 +1,25 @@
+package keyed
+
+import "github.com/aperturerobotics/util/routine"
+
+// GetExitHistory returns the recent runs of the routine for the key from
+// oldest to newest.
+//
+// The history is kept across restarts and resets of the key.
+// Returns false if the key does not exist.
+// Returns nil if WithExitHistory was not set.
+func (k *Keyed[K, V]) GetExitHistory(key K) ([]routine.ExitRecord, bool) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	v, existed := k.routines[key]
+	if !existed {
+		return nil, false
+	}
+	return v.exitHistory.Records(), true
+}
+
+// newExitHistory constructs the exit history for a routine, if enabled.
+func (k *Keyed[K, V]) newExitHistory() *routine.ExitHistory {
+	return routine.NewExitHistory(k.exitHistorySize)
+}
@@ -40,6 +40,57 @@ func WithReleaseDelay[K comparable, V any](delay time.Duration) Option[K, V] {
 	})
 }
 
+// WithMaxConcurrency limits the number of routines running at once.
+//
+// Routines started while the limit is reached are queued in the order they
+// were started and run as slots become available. Routines waiting for a
+// retry backoff do not hold a slot. If n <= 0, the limit is disabled.
+func WithMaxConcurrency[K comparable, V any](n int) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.maxConcurrency = max(n, 0)
+	})
+}
+
+// WithMaxIdleKeys keeps up to n unreferenced keys running in KeyedRefCount.
+//
+// When the last reference to a key is released, the key is kept in an idle
+// list instead of being removed. If there are more than n idle keys, the least
+// recently used key is evicted. Adding a reference removes a key from the idle
+// list. If n <= 0, the number of idle keys is not limited. If neither n nor an
+// idle TTL is set, keys are removed when the last reference is released.
+//
+// Has no effect on Keyed. Combine with WithIdleTTL to also expire idle keys.
+func WithMaxIdleKeys[K comparable, V any](n int) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.maxIdleKeys = max(n, 0)
+	})
+}
+
+// WithIdleTTL keeps unreferenced keys running in KeyedRefCount for ttl.
+//
+// When the last reference to a key is released, the key is kept in an idle
+// list and evicted once ttl has passed without a new reference. If ttl <= 0,
+// idle keys do not expire. If neither ttl nor a max number of idle keys is
+// set, keys are removed when the last reference is released.
+//
+// Has no effect on Keyed. Combine with WithMaxIdleKeys to limit the idle keys.
+func WithIdleTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.idleTTL = max(ttl, 0)
+	})
+}
+
+// WithEvictCb adds a callback after a key is evicted from the KeyedRefCount idle list.
+//
+// The key is removed from the set before the callback is called.
+func WithEvictCb[K comparable, V any](cb func(key K, data V)) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		if cb != nil {
+			k.evictCbs = append(k.evictCbs, cb)
+		}
+	})
+}
+
 // WithRetry adds a retry after a routine exits with an error.
 //
 // If the backoff config is nil, disables retry.
@@ -64,6 +115,67 @@ func WithBackoff[K comparable, V any](cb func(k K) cbackoff.BackOff) Option[K, V
 	})
 }
 
+// WithCircuitBreaker parks a key after repeated failures.
+//
+// If the routine fails maxFailures times within window, the breaker opens and
+// the routine is not started or retried until cooldown has passed. After the
+// cooldown a single probe run is allowed (half-open). If the probe exits with
+// an error before window has passed the breaker opens again, otherwise it
+// closes. Use ResetCircuitBreaker to close the breaker manually.
+//
+// If maxFailures <= 0, disables the circuit breaker.
+func WithCircuitBreaker[K comparable, V any](maxFailures int, window, cooldown time.Duration) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		if maxFailures <= 0 {
+			k.breakerConf = nil
+			return
+		}
+		k.breakerConf = &breakerConfig{
+			maxFailures: maxFailures,
+			window:      window,
+			cooldown:    cooldown,
+		}
+	})
+}
+
+// WithHeartbeat enables a heartbeat watchdog for the routines.
+//
+// The routines must call routine.Heartbeat with their context at least once
+// per interval. If no heartbeat is received within interval, the routine
+// context is canceled and the routine is marked as exited with
+// routine.ErrStalled without waiting for it to return. The routine is then
+// restarted with the retry backoff, if set. A stalled routine releases its
+// WithMaxConcurrency slot when it is marked as exited, even if the goroutine
+// has not returned yet.
+// disables the watchdog if interval <= 0
+func WithHeartbeat[K comparable, V any](interval time.Duration) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.heartbeat = max(interval, 0)
+	})
+}
+
+// WithPanicRecovery recovers panics in the routines.
+//
+// A panic is returned from the routine as a *panics.PanicError with the panic
+// value and stack trace, and is passed to the exit callbacks, the retry backoff
+// and the circuit breaker like any other error. Calls the global hook set with
+// panics.SetHook.
+func WithPanicRecovery[K comparable, V any]() Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.recoverPanics = true
+	})
+}
+
+// WithExitHistory keeps a history of the last n runs of each routine.
+//
+// Use GetExitHistory to read the history for a key.
+// disables the history if n <= 0
+func WithExitHistory[K comparable, V any](n int) Option[K, V] {
+	return newOption(func(k *Keyed[K, V]) {
+		k.exitHistorySize = max(n, 0)
+	})
+}
+
 // WithExitCb adds a callback after a routine exits.
 func WithExitCb[K comparable, V any](cb func(key K, routine Routine, data V, err error)) Option[K, V] {
 	return newOption(func(k *Keyed[K, V]) {
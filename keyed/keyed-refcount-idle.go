@@ -0,0 +1,98 @@
+package keyed
+
+import (
+	"container/list"
+	"time"
+)
+
+// idleKey is an unreferenced key kept alive in the idle list.
+type idleKey[K comparable] struct {
+	// key is the idle key
+	key K
+	// elem is the element in the idle list
+	elem *list.Element
+	// ttlTimer evicts the key after the idle TTL, if set.
+	ttlTimer *time.Timer
+}
+
+// releaseLastRefLocked is called when the last reference to a key is released.
+// Keeps the key in the idle list if enabled, otherwise removes the key.
+// Returns any keys evicted from the idle list.
+// expects mtx to be locked by caller
+func (k *KeyedRefCount[K, V]) releaseLastRefLocked(key K) []KeyWithData[K, V] {
+	maxIdle, idleTTL := k.keyed.maxIdleKeys, k.keyed.idleTTL
+	if maxIdle <= 0 && idleTTL <= 0 {
+		_ = k.keyed.RemoveKey(key)
+		return nil
+	}
+
+	ik := &idleKey[K]{key: key}
+	ik.elem = k.idle.PushFront(ik)
+	k.idleKeys[key] = ik
+	if idleTTL > 0 {
+		ik.ttlTimer = time.AfterFunc(idleTTL, func() {
+			k.mtx.Lock()
+			var evicted []KeyWithData[K, V]
+			if k.idleKeys[key] == ik {
+				evicted = append(evicted, k.evictIdleLocked(ik))
+			}
+			k.mtx.Unlock()
+			k.callEvictCbs(evicted)
+		})
+	}
+
+	var evicted []KeyWithData[K, V]
+	for maxIdle > 0 && k.idle.Len() > maxIdle {
+		lru := k.idle.Back().Value.(*idleKey[K])
+		evicted = append(evicted, k.evictIdleLocked(lru))
+	}
+	return evicted
+}
+
+// unidleLocked removes the key from the idle list, if present.
+// Returns if the key was idle.
+// expects mtx to be locked by caller
+func (k *KeyedRefCount[K, V]) unidleLocked(key K) bool {
+	ik, ok := k.idleKeys[key]
+	if !ok {
+		return false
+	}
+	if ik.ttlTimer != nil {
+		_ = ik.ttlTimer.Stop()
+	}
+	k.idle.Remove(ik.elem)
+	delete(k.idleKeys, key)
+	return true
+}
+
+// evictIdleLocked removes an idle key from the idle list and the keyed set.
+// expects mtx to be locked by caller
+func (k *KeyedRefCount[K, V]) evictIdleLocked(ik *idleKey[K]) KeyWithData[K, V] {
+	_ = k.unidleLocked(ik.key)
+	data, _ := k.keyed.GetKey(ik.key)
+	_ = k.keyed.RemoveKey(ik.key)
+	return KeyWithData[K, V]{Key: ik.key, Data: data}
+}
+
+// callEvictCbs calls the eviction callbacks for the evicted keys.
+// expects mtx to not be locked by caller
+func (k *KeyedRefCount[K, V]) callEvictCbs(evicted []KeyWithData[K, V]) {
+	for _, ev := range evicted {
+		for _, cb := range k.keyed.evictCbs {
+			cb(ev.Key, ev.Data)
+		}
+	}
+}
+
+// GetIdleKeys returns the list of unreferenced keys kept alive in the idle list.
+// The keys are ordered from most to least recently used.
+func (k *KeyedRefCount[K, V]) GetIdleKeys() []K {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	keys := make([]K, 0, k.idle.Len())
+	for e := k.idle.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*idleKey[K]).key)
+	}
+	return keys
+}
@@ -1,10 +1,12 @@
 package keyed
 
 import (
+	"container/list"
 	"context"
 	"sync"
 	"sync/atomic"
 
+	"github.com/aperturerobotics/util/routine"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,6 +19,11 @@ type KeyedRefCount[K comparable, V any] struct {
 	mtx sync.Mutex
 	// refs is the list of keyed refs.
 	refs map[K][]*KeyedRef[K, V]
+	// idle is the list of unreferenced keys kept alive.
+	// the front of the list is the most recently used key.
+	idle *list.List
+	// idleKeys maps keys to entries in the idle list.
+	idleKeys map[K]*idleKey[K]
 }
 
 // KeyedRef is a reference to a key.
@@ -34,6 +41,7 @@ func (k *KeyedRef[K, V]) Release() {
 	if k.rel.Swap(true) {
 		return
 	}
+	var evicted []KeyWithData[K, V]
 	k.rc.mtx.Lock()
 	refs := k.rc.refs[k.key]
 	for i := 0; i < len(refs); i++ {
@@ -44,7 +52,7 @@ func (k *KeyedRef[K, V]) Release() {
 
 			if len(refs) == 0 {
 				delete(k.rc.refs, k.key)
-				_ = k.rc.keyed.RemoveKey(k.key)
+				evicted = k.rc.releaseLastRefLocked(k.key)
 			} else {
 				k.rc.refs[k.key] = refs
 			}
@@ -52,6 +60,7 @@ func (k *KeyedRef[K, V]) Release() {
 		}
 	}
 	k.rc.mtx.Unlock()
+	k.rc.callEvictCbs(evicted)
 }
 
 // NewKeyedRefCount constructs a new Keyed execution manager with reference counting.
@@ -60,10 +69,7 @@ func NewKeyedRefCount[K comparable, V any](
 	ctorCb func(key K) (Routine, V),
 	opts ...Option[K, V],
 ) *KeyedRefCount[K, V] {
-	return &KeyedRefCount[K, V]{
-		keyed: NewKeyed(ctorCb, opts...),
-		refs:  make(map[K][]*KeyedRef[K, V]),
-	}
+	return newKeyedRefCount(NewKeyed(ctorCb, opts...))
 }
 
 // NewKeyedRefCountWithLogger constructs a new Keyed execution manager with reference counting.
@@ -74,9 +80,16 @@ func NewKeyedRefCountWithLogger[K comparable, V any](
 	le *logrus.Entry,
 	opts ...Option[K, V],
 ) *KeyedRefCount[K, V] {
+	return newKeyedRefCount(NewKeyedWithLogger(ctorCb, le, opts...))
+}
+
+// newKeyedRefCount constructs a new KeyedRefCount wrapping a Keyed.
+func newKeyedRefCount[K comparable, V any](keyed *Keyed[K, V]) *KeyedRefCount[K, V] {
 	return &KeyedRefCount[K, V]{
-		keyed: NewKeyedWithLogger(ctorCb, le, opts...),
-		refs:  make(map[K][]*KeyedRef[K, V]),
+		keyed:    keyed,
+		refs:     make(map[K][]*KeyedRef[K, V]),
+		idle:     list.New(),
+		idleKeys: make(map[K]*idleKey[K]),
 	}
 }
 
@@ -93,6 +106,35 @@ func (k *KeyedRefCount[K, V]) ClearContext() {
 	k.keyed.ClearContext()
 }
 
+// SubscribeEvents adds a callback for key lifecycle events.
+//
+// Events are delivered in order of Seq. The callback is called with the Keyed
+// mutex locked: it must not block or call any methods on the KeyedRefCount.
+// Returns a function to cancel the subscription.
+func (k *KeyedRefCount[K, V]) SubscribeEvents(cb func(ev Event[K])) (cancel func()) {
+	return k.keyed.SubscribeEvents(cb)
+}
+
+// WaitAllExited waits for all running routines to return.
+//
+// Does not cancel the routines: use Shutdown to cancel and wait.
+// Returns context.Canceled if ctx is canceled.
+func (k *KeyedRefCount[K, V]) WaitAllExited(ctx context.Context) error {
+	return k.keyed.WaitAllExited(ctx)
+}
+
+// Shutdown clears the context and waits for all routines to return.
+//
+// Returns a joined error of RoutineError for each routine that failed, either
+// before or during the shutdown. context.Canceled errors returned by the
+// routines are ignored. If ctx is canceled before all routines exited,
+// context.Canceled is also joined.
+//
+// The keys and references are kept: calling SetContext again restarts the routines.
+func (k *KeyedRefCount[K, V]) Shutdown(ctx context.Context) error {
+	return k.keyed.Shutdown(ctx)
+}
+
 // GetKeys returns the list of keys registered with the Keyed instance.
 func (k *KeyedRefCount[K, V]) GetKeys() []K {
 	return k.keyed.GetKeys()
@@ -103,6 +145,33 @@ func (k *KeyedRefCount[K, V]) GetKeysWithData() []KeyWithData[K, V] {
 	return k.keyed.GetKeysWithData()
 }
 
+// GetKeyStatus returns a snapshot of the status for the given key.
+// Returns false if the key does not exist.
+func (k *KeyedRefCount[K, V]) GetKeyStatus(key K) (KeyStatus[K], bool) {
+	return k.keyed.GetKeyStatus(key)
+}
+
+// GetExitHistory returns the recent runs of the routine for the key from
+// oldest to newest.
+// Returns false if the key does not exist.
+func (k *KeyedRefCount[K, V]) GetExitHistory(key K) ([]routine.ExitRecord, bool) {
+	return k.keyed.GetExitHistory(key)
+}
+
+// GetAllStatuses returns a snapshot of the status of all keys.
+func (k *KeyedRefCount[K, V]) GetAllStatuses() []KeyStatus[K] {
+	return k.keyed.GetAllStatuses()
+}
+
+// ResetCircuitBreaker closes the circuit breaker for the given key.
+//
+// Clears the failure history. If the breaker was open, the routine is
+// restarted immediately. Returns false if the key does not exist or the
+// circuit breaker is not enabled.
+func (k *KeyedRefCount[K, V]) ResetCircuitBreaker(key K) bool {
+	return k.keyed.ResetCircuitBreaker(key)
+}
+
 // GetKey returns the value for the given key and if it existed.
 func (k *KeyedRefCount[K, V]) GetKey(key K) (V, bool) {
 	return k.keyed.GetKey(key)
@@ -157,6 +226,7 @@ func (k *KeyedRefCount[K, V]) RemoveKey(key K) bool {
 		ref.rel.Store(true)
 	}
 	delete(k.refs, key)
+	_ = k.unidleLocked(key)
 
 	// return if the key existed
 	return k.keyed.RemoveKey(key)
@@ -168,9 +238,26 @@ func (k *KeyedRefCount[K, V]) AddKeyRef(key K) (ref *KeyedRef[K, V], data V, exi
 	k.mtx.Lock()
 	refs := k.refs[key]
 	nref := &KeyedRef[K, V]{rc: k, key: key}
+	_ = k.unidleLocked(key)
 	data, existed = k.keyed.SetKey(key, true)
 	refs = append(refs, nref)
 	k.refs[key] = refs
 	k.mtx.Unlock()
 	return nref, data, existed
 }
+
+// AddKeyRefWait adds a reference to the given key and waits for the routine to be ready.
+//
+// Returns the value passed to ready. Routines which are not a ReadyRoutine
+// are ready once started and return the key data.
+// If the routine exits before it is ready, or ctx is canceled, releases the
+// reference and returns the error.
+func (k *KeyedRefCount[K, V]) AddKeyRefWait(ctx context.Context, key K) (*KeyedRef[K, V], V, error) {
+	ref, _, _ := k.AddKeyRef(key)
+	val, err := k.keyed.WaitKeyReady(ctx, key)
+	if err != nil {
+		ref.Release()
+		return nil, val, err
+	}
+	return ref, val, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	cbackoff "github.com/aperturerobotics/util/backoff/cbackoff"
+	"github.com/aperturerobotics/util/linkedlist"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,6 +22,9 @@ type Routine func(ctx context.Context) error
 type Keyed[K comparable, V any] struct {
 	// ctorCb is the constructor callback
 	ctorCb func(key K) (Routine, V)
+	// readyCtorCb is the constructor callback for ReadyRoutine.
+	// if set, used instead of ctorCb.
+	readyCtorCb func(key K) (ReadyRoutine[V], V)
 	// exitedCbs is the set of exited callbacks.
 	exitedCbs []func(key K, routine Routine, data V, err error)
 
@@ -29,6 +33,23 @@ type Keyed[K comparable, V any] struct {
 	// backoffFactory is the backoff factory
 	// if nil, backoff is disabled
 	backoffFactory func(k K) cbackoff.BackOff
+	// maxConcurrency is the concurrency limit or 0 if none
+	maxConcurrency int
+	// maxIdleKeys is the max number of unreferenced keys kept by KeyedRefCount.
+	maxIdleKeys int
+	// idleTTL is the time to keep unreferenced keys in KeyedRefCount.
+	idleTTL time.Duration
+	// evictCbs is the set of callbacks for keys evicted from the idle list.
+	evictCbs []func(key K, data V)
+	// breakerConf is the circuit breaker config
+	// if nil, the circuit breaker is disabled
+	breakerConf *breakerConfig
+	// heartbeat is the heartbeat watchdog interval, if enabled.
+	heartbeat time.Duration
+	// recoverPanics indicates panics in the routines are recovered.
+	recoverPanics bool
+	// exitHistorySize is the number of runs to keep in the history per key.
+	exitHistorySize int
 
 	// mtx guards below fields
 	mtx sync.Mutex
@@ -36,6 +57,34 @@ type Keyed[K comparable, V any] struct {
 	ctx context.Context
 	// routines is the set of running routines
 	routines map[K]*runningRoutine[K, V]
+	// running is the number of routines holding a concurrency slot.
+	// a stalled routine releases its slot before its goroutine returns.
+	running int
+	// live is the number of routine goroutines which have not returned.
+	live int
+	// idleCh is closed when live becomes zero.
+	// may be nil if nothing is waiting
+	idleCh chan struct{}
+	// collectors is the list of active exit collectors.
+	collectors []*exitCollector
+	// startQueue is the queue of routines waiting for a concurrency slot.
+	// entries may be stale, see runningRoutine.queueSeq.
+	startQueue *linkedlist.LinkedList[queuedRoutine[K, V]]
+	// eventSubs is the list of event subscriptions.
+	eventSubs []*eventSub[K]
+	// eventSeq is the sequence number of the last event.
+	eventSeq uint64
+	// stateCh is closed when a routine becomes ready, exits, or is removed.
+	// may be nil if nothing is waiting
+	stateCh chan struct{}
+}
+
+// queuedRoutine is an entry in the start queue.
+type queuedRoutine[K comparable, V any] struct {
+	// r is the queued routine
+	r *runningRoutine[K, V]
+	// seq is the value of r.queueSeq when the entry was pushed
+	seq uint64
 }
 
 // NewKeyed constructs a new Keyed execution manager.
@@ -53,7 +102,8 @@ func NewKeyed[K comparable, V any](
 	k := &Keyed[K, V]{
 		ctorCb: ctorCb,
 
-		routines: make(map[K]*runningRoutine[K, V], 1),
+		routines:   make(map[K]*runningRoutine[K, V], 1),
+		startQueue: linkedlist.NewLinkedList[queuedRoutine[K, V]](),
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -75,6 +125,35 @@ func NewKeyedWithLogger[K comparable, V any](
 	return NewKeyed(ctorCb, append([]Option[K, V]{WithExitLogger[K, V](le)}, opts...)...)
 }
 
+// newRunningRoutineLocked calls the constructor and builds a runningRoutine for the key.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) newRunningRoutineLocked(key K) *runningRoutine[K, V] {
+	if k.readyCtorCb == nil {
+		routine, data := k.ctorCb(key)
+		return newRunningRoutine(k, key, routine, data, k.backoffFactory)
+	}
+
+	readyRoutine, data := k.readyCtorCb(key)
+	var routine Routine
+	if readyRoutine != nil {
+		routine = func(ctx context.Context) error {
+			return readyRoutine(ctx, func(val V) {})
+		}
+	}
+	r := newRunningRoutine(k, key, routine, data, k.backoffFactory)
+	r.readyRoutine = readyRoutine
+	return r
+}
+
+// notifyStateLocked wakes any routines waiting for a state change.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) notifyStateLocked() {
+	if k.stateCh != nil {
+		close(k.stateCh)
+		k.stateCh = nil
+	}
+}
+
 // SetContext updates the root context, restarting all running routines.
 //
 // nil context is valid and will shutdown the routines.
@@ -108,6 +187,50 @@ func (k *Keyed[K, V]) setContextLocked(ctx context.Context, restart bool) {
 			}
 		}
 	}
+	k.startQueuedLocked()
+}
+
+// tryAcquireSlotLocked reserves a concurrency slot if one is available.
+// Returns false if any routines are queued to keep the queue order.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) tryAcquireSlotLocked() bool {
+	if k.maxConcurrency > 0 && (k.running >= k.maxConcurrency || !k.startQueue.IsEmpty()) {
+		return false
+	}
+	k.running++
+	return true
+}
+
+// releaseSlotLocked releases a concurrency slot and starts the next queued routines.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) releaseSlotLocked() {
+	k.running--
+	k.startQueuedLocked()
+}
+
+// startQueuedLocked starts queued routines while concurrency slots are available.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) startQueuedLocked() {
+	for k.ctx != nil && k.ctx.Err() == nil && (k.maxConcurrency <= 0 || k.running < k.maxConcurrency) {
+		qr, ok := k.startQueue.Pop()
+		if !ok {
+			break
+		}
+		r := qr.r
+		if !r.queued || r.queueSeq != qr.seq {
+			// stale entry
+			continue
+		}
+		r.queued = false
+		waitCh := r.queuedWaitCh
+		r.queuedWaitCh = nil
+		if k.routines[r.key] != r {
+			// removed or reset while queued
+			continue
+		}
+		k.running++
+		r.launch(k.ctx, waitCh)
+	}
 }
 
 // ClearContext clears the context and shuts down any running routines.
@@ -159,9 +282,9 @@ func (k *Keyed[K, V]) SetKey(key K, start bool) (V, bool) {
 
 	v, existed := k.routines[key]
 	if !existed {
-		routine, data := k.ctorCb(key)
-		v = newRunningRoutine(k, key, routine, data, k.backoffFactory)
+		v = k.newRunningRoutineLocked(key)
 		k.routines[key] = v
+		k.emitLocked(EventAdded, key, nil, 0)
 	} else {
 		if v.deferRemove != nil {
 			// cancel removing this key
@@ -215,10 +338,10 @@ func (k *Keyed[K, V]) SyncKeys(keys []K, restart bool) (added, removed []K) {
 
 		v, existed := k.routines[key]
 		if !existed {
-			routine, data := k.ctorCb(key)
-			v = newRunningRoutine(k, key, routine, data, k.backoffFactory)
+			v = k.newRunningRoutineLocked(key)
 			k.routines[key] = v
 			added = append(added, key)
+			k.emitLocked(EventAdded, key, nil, 0)
 		}
 
 		routines[key] = v
@@ -312,10 +435,16 @@ func (k *Keyed[K, V]) resetRoutineLocked(key K, conds ...func(K, V) bool) (exist
 	if v.ctxCancel != nil {
 		v.ctxCancel()
 	}
+	v.dequeue()
+	v.stopBreakerLocked()
 	prevExitedCh := v.exitedCh
-	routine, data := k.ctorCb(key)
-	v = newRunningRoutine(k, key, routine, data, k.backoffFactory)
+	exitHistory := v.exitHistory
+	v = k.newRunningRoutineLocked(key)
+	if exitHistory != nil {
+		v.exitHistory = exitHistory
+	}
 	k.routines[key] = v
+	k.emitLocked(EventReset, key, nil, 0)
 	if k.ctx != nil {
 		v.start(k.ctx, prevExitedCh, false)
 	}
@@ -325,6 +454,7 @@ func (k *Keyed[K, V]) resetRoutineLocked(key K, conds ...func(K, V) bool) (exist
 
 // RestartRoutine restarts the given routine after checking the condition functions.
 // If any return true, and the routine is running, restarts the instance.
+// Does not restart routines parked by the circuit breaker.
 //
 // If len(conds) == 0, always resets the given key.
 func (k *Keyed[K, V]) RestartRoutine(key K, conds ...func(K, V) bool) (existed bool, reset bool) {
@@ -376,6 +506,10 @@ func (k *Keyed[K, V]) restartRoutineLocked(key K, conds ...func(K, V) bool) (exi
 	if !anyMatched {
 		return true, false
 	}
+	if v.breaker != nil && v.breaker.state == BreakerOpen {
+		// parked by the circuit breaker
+		return true, false
+	}
 
 	if v.ctxCancel != nil {
 		v.ctxCancel()
@@ -383,6 +517,7 @@ func (k *Keyed[K, V]) restartRoutineLocked(key K, conds ...func(K, V) bool) (exi
 	}
 	if k.ctx != nil {
 		prevExitedCh := v.exitedCh
+		k.emitLocked(EventRestarted, key, nil, 0)
 		v.start(k.ctx, prevExitedCh, true)
 	}
 
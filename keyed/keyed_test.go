@@ -12,6 +12,9 @@ import (
 	"time"
 
 	"github.com/aperturerobotics/util/backoff"
+	"github.com/aperturerobotics/util/ccontainer"
+	"github.com/aperturerobotics/util/panics"
+	"github.com/aperturerobotics/util/routine"
 	"github.com/sirupsen/logrus"
 )
 
@@ -646,3 +649,812 @@ func TestContextCancellation(t *testing.T) {
 	}
 	mu.Unlock()
 }
+
+// TestKeyed_WithMaxConcurrency tests limiting the number of running routines.
+func TestKeyed_WithMaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+	started := make(chan string, 10)
+	release := make(map[string]chan struct{})
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		release[key] = make(chan struct{})
+	}
+
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				started <- key
+				select {
+				case <-ctx.Done():
+					return context.Canceled
+				case <-release[key]:
+					return nil
+				}
+			}, &testData{}
+		},
+		WithMaxConcurrency[string, *testData](2),
+	)
+	k.SetContext(ctx, false)
+	_, _ = k.SyncKeys(keys, false)
+
+	expectStarted := func(key string) {
+		t.Helper()
+		select {
+		case val := <-started:
+			if val != key {
+				t.Fatalf("expected %s to start but got %s", key, val)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s to start", key)
+		}
+	}
+	expectNoneStarted := func() {
+		t.Helper()
+		select {
+		case val := <-started:
+			t.Fatalf("unexpected start: %s", val)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+
+	gotFirst := []string{<-started, <-started}
+	slices.Sort(gotFirst)
+	if !slices.Equal(gotFirst, []string{"a", "b"}) {
+		t.Fatalf("unexpected first routines: %v", gotFirst)
+	}
+	expectNoneStarted()
+
+	// exiting a routine frees a slot for the next queued routine
+	close(release["a"])
+	expectStarted("c")
+	expectNoneStarted()
+
+	// removing a queued key skips it
+	_ = k.RemoveKey("d")
+	_ = k.RemoveKey("b")
+	expectStarted("e")
+	expectNoneStarted()
+}
+
+// TestKeyed_SubscribeEvents tests the key lifecycle events.
+func TestKeyed_SubscribeEvents(t *testing.T) {
+	ctx := context.Background()
+	var attempts atomic.Int32
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				if attempts.Add(1) == 1 {
+					return errors.New("returning error to test retry")
+				}
+				<-ctx.Done()
+				return context.Canceled
+			}, &testData{}
+		},
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_CONSTANT,
+			Constant:    &backoff.Constant{Interval: 10},
+		}),
+	)
+
+	evCh := make(chan Event[string], 32)
+	cancel := k.SubscribeEvents(func(ev Event[string]) {
+		evCh <- ev
+	})
+	defer cancel()
+
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test", false)
+
+	var lastSeq uint64
+	expectEvent := func(kind EventKind) Event[string] {
+		t.Helper()
+		select {
+		case ev := <-evCh:
+			if ev.Kind != kind {
+				t.Fatalf("expected %v event but got %v", kind, ev.Kind)
+			}
+			if ev.Key != "test" {
+				t.Fatalf("unexpected key: %s", ev.Key)
+			}
+			if ev.Seq != lastSeq+1 {
+				t.Fatalf("expected seq %d but got %d", lastSeq+1, ev.Seq)
+			}
+			lastSeq = ev.Seq
+			return ev
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v event", kind)
+			return Event[string]{}
+		}
+	}
+
+	expectEvent(EventAdded)
+	expectEvent(EventStarted)
+	expectEvent(EventReady)
+	if ev := expectEvent(EventExited); ev.Err == nil {
+		t.Fatal("expected exited event to have an error")
+	}
+	if ev := expectEvent(EventBackoff); ev.Err == nil || ev.Delay <= 0 {
+		t.Fatalf("unexpected backoff event: %v", ev)
+	}
+	expectEvent(EventRetry)
+	expectEvent(EventStarted)
+	expectEvent(EventReady)
+
+	_, _ = k.RestartRoutine("test")
+	expectEvent(EventRestarted)
+	expectEvent(EventStarted)
+	expectEvent(EventReady)
+
+	_ = k.RemoveKey("test")
+	expectEvent(EventRemoved)
+
+	// exit of the canceled routine
+	if ev := expectEvent(EventExited); ev.Err != context.Canceled {
+		t.Fatalf("expected canceled exit but got %v", ev.Err)
+	}
+}
+
+// TestKeyed_GetKeyStatus tests the key status snapshots.
+func TestKeyed_GetKeyStatus(t *testing.T) {
+	ctx := context.Background()
+	testErr := errors.New("test error")
+	exitedCh := make(chan struct{}, 1)
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				return testErr
+			}, &testData{}
+		},
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_CONSTANT,
+			Constant:    &backoff.Constant{Interval: 60000},
+		}),
+		WithExitCb(func(key string, routine Routine, data *testData, err error) {
+			exitedCh <- struct{}{}
+		}),
+	)
+
+	if _, ok := k.GetKeyStatus("test"); ok {
+		t.Fatal("expected key to not exist")
+	}
+
+	_, _ = k.SetKey("test", false)
+	status, ok := k.GetKeyStatus("test")
+	if !ok || status.State != KeyStateStopped || !status.LastStarted.IsZero() {
+		t.Fatalf("unexpected status before set context: %v", status)
+	}
+
+	k.SetContext(ctx, false)
+	<-exitedCh
+
+	status, ok = k.GetKeyStatus("test")
+	if !ok || status.State != KeyStateRetrying {
+		t.Fatalf("expected retrying state: %v", status)
+	}
+	if status.LastErr != testErr || status.LastStarted.IsZero() || status.RestartCount != 0 {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if time.Until(status.NextRetry) <= 0 {
+		t.Fatalf("expected next retry in the future: %v", status.NextRetry)
+	}
+
+	_, _ = k.RestartRoutine("test")
+	<-exitedCh
+
+	statuses := k.GetAllStatuses()
+	if len(statuses) != 1 || statuses[0].Key != "test" || statuses[0].RestartCount != 1 {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+// TestKeyed_WithCircuitBreaker tests parking keys after repeated failures.
+func TestKeyed_WithCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	var attempts atomic.Int32
+	var succeed atomic.Bool
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				attempts.Add(1)
+				if succeed.Load() {
+					return nil
+				}
+				return errors.New("returning error to test breaker")
+			}, &testData{}
+		},
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_CONSTANT,
+			Constant:    &backoff.Constant{Interval: 1},
+		}),
+		WithCircuitBreaker[string, *testData](3, time.Second, time.Millisecond*100),
+	)
+
+	evCh := make(chan Event[string], 64)
+	defer k.SubscribeEvents(func(ev Event[string]) {
+		switch ev.Kind {
+		case EventBreakerOpen, EventBreakerHalfOpen, EventBreakerClosed:
+			evCh <- ev
+		}
+	})()
+	expectEvent := func(kind EventKind) {
+		t.Helper()
+		select {
+		case ev := <-evCh:
+			if ev.Kind != kind {
+				t.Fatalf("expected %v event but got %v", kind, ev.Kind)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v event", kind)
+		}
+	}
+
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test", false)
+
+	expectEvent(EventBreakerOpen)
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("expected 3 attempts before parking but got %d", n)
+	}
+	status, _ := k.GetKeyStatus("test")
+	if status.State != KeyStateParked || status.Breaker != BreakerOpen || status.NextRetry.IsZero() {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if _, restarted := k.RestartRoutine("test"); restarted {
+		t.Fatal("expected parked routine to not restart")
+	}
+
+	// the probe run fails and opens the breaker again
+	expectEvent(EventBreakerHalfOpen)
+	expectEvent(EventBreakerOpen)
+	if n := attempts.Load(); n != 4 {
+		t.Fatalf("expected 4 attempts after probe but got %d", n)
+	}
+
+	succeed.Store(true)
+	if !k.ResetCircuitBreaker("test") {
+		t.Fatal("expected reset to succeed")
+	}
+	expectEvent(EventBreakerClosed)
+	status, _ = k.GetKeyStatus("test")
+	if status.Breaker != BreakerClosed || status.State == KeyStateParked {
+		t.Fatalf("unexpected status after reset: %v", status)
+	}
+	deadline := time.Now().Add(time.Second)
+	for attempts.Load() != 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 5 attempts but got %d", attempts.Load())
+		}
+		runtime.Gosched()
+	}
+}
+
+// TestKeyedRefCount_IdleKeys tests keeping unreferenced keys in the idle list.
+func TestKeyedRefCount_IdleKeys(t *testing.T) {
+	ctx := context.Background()
+	evictedCh := make(chan string, 10)
+	k := NewKeyedRefCount(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				<-ctx.Done()
+				return context.Canceled
+			}, &testData{value: key}
+		},
+		WithMaxIdleKeys[string, *testData](2),
+		WithIdleTTL[string, *testData](time.Millisecond*100),
+		WithEvictCb(func(key string, data *testData) {
+			if data.value != key {
+				t.Errorf("unexpected data for evicted key %s: %v", key, data.value)
+			}
+			evictedCh <- key
+		}),
+	)
+	k.SetContext(ctx, false)
+
+	expectEvicted := func(key string) {
+		t.Helper()
+		select {
+		case val := <-evictedCh:
+			if val != key {
+				t.Fatalf("expected %s to be evicted but got %s", key, val)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %s to be evicted", key)
+		}
+	}
+
+	refA, _, _ := k.AddKeyRef("a")
+	refB, _, _ := k.AddKeyRef("b")
+	refC, _, _ := k.AddKeyRef("c")
+	refA.Release()
+	refB.Release()
+	if idle := k.GetIdleKeys(); !slices.Equal(idle, []string{"b", "a"}) {
+		t.Fatalf("unexpected idle keys: %v", idle)
+	}
+	if keys := k.GetKeys(); len(keys) != 3 {
+		t.Fatalf("expected idle keys to be kept: %v", keys)
+	}
+
+	// re-referencing a key removes it from the idle list
+	refA, _, existed := k.AddKeyRef("a")
+	if !existed {
+		t.Fatal("expected idle key to still exist")
+	}
+	refA.Release()
+	if idle := k.GetIdleKeys(); !slices.Equal(idle, []string{"a", "b"}) {
+		t.Fatalf("unexpected idle keys: %v", idle)
+	}
+
+	// exceeding the limit evicts the least recently used key
+	refC.Release()
+	expectEvicted("b")
+	if _, ok := k.GetKey("b"); ok {
+		t.Fatal("expected evicted key to be removed")
+	}
+
+	// the idle ttl evicts the remaining keys
+	got := []string{<-evictedCh, <-evictedCh}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("unexpected evicted keys: %v", got)
+	}
+	if keys := k.GetKeys(); len(keys) != 0 {
+		t.Fatalf("expected all keys to be removed: %v", keys)
+	}
+}
+
+// TestKeyed_Shutdown tests waiting for all routines to exit on shutdown.
+func TestKeyed_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	flushErr := errors.New("flush failed")
+	var exited atomic.Int32
+	startedCh := make(chan struct{}, 3)
+	k := NewKeyed(func(key string) (Routine, *testData) {
+		return func(ctx context.Context) error {
+			startedCh <- struct{}{}
+			<-ctx.Done()
+			// simulate flushing state after cancel
+			<-time.After(time.Millisecond * 20)
+			exited.Add(1)
+			if key == "b" {
+				return flushErr
+			}
+			return context.Canceled
+		}, &testData{}
+	})
+	k.SetContext(ctx, false)
+	_, _ = k.SyncKeys([]string{"a", "b", "c"}, false)
+	for range 3 {
+		<-startedCh
+	}
+
+	err := k.Shutdown(ctx)
+	if n := exited.Load(); n != 3 {
+		t.Fatalf("expected all routines to have exited but got %d", n)
+	}
+	var rerr *RoutineError[string]
+	if !errors.As(err, &rerr) || rerr.Key != "b" || !errors.Is(err, flushErr) {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if err := k.WaitAllExited(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// shutdown times out if a routine does not exit
+	k = NewKeyed(func(key string) (Routine, *testData) {
+		return func(ctx context.Context) error {
+			startedCh <- struct{}{}
+			<-ctx.Done()
+			<-time.After(time.Millisecond * 200)
+			return nil
+		}, &testData{}
+	})
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("a", false)
+	<-startedCh
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Millisecond*20)
+	defer timeoutCancel()
+	if err := k.Shutdown(timeoutCtx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected shutdown to be canceled: %v", err)
+	}
+}
+
+// TestKeyedRefCount_AddKeyRefWait tests waiting for a ReadyRoutine to be ready.
+func TestKeyedRefCount_AddKeyRefWait(t *testing.T) {
+	ctx := context.Background()
+	dialErr := errors.New("dial failed")
+	proceed := make(chan struct{})
+	k := NewKeyedRefCountWithReady(func(key string) (ReadyRoutine[*testData], *testData) {
+		return func(ctx context.Context, ready func(val *testData)) error {
+			if key == "fail" {
+				return dialErr
+			}
+			// simulate dialing a connection
+			<-proceed
+			ready(&testData{value: key + "-conn"})
+			<-ctx.Done()
+			return context.Canceled
+		}, &testData{value: key}
+	})
+	k.SetContext(ctx, false)
+
+	resultCh := make(chan *testData, 1)
+	go func() {
+		ref, val, err := k.AddKeyRefWait(ctx, "ok")
+		if err != nil {
+			t.Error(err.Error())
+			resultCh <- nil
+			return
+		}
+		defer ref.Release()
+		resultCh <- val
+	}()
+
+	select {
+	case <-resultCh:
+		t.Fatal("expected wait to block until ready")
+	case <-time.After(time.Millisecond * 50):
+	}
+	close(proceed)
+	if val := <-resultCh; val == nil || val.value != "ok-conn" {
+		t.Fatalf("unexpected ready value: %v", val)
+	}
+
+	ref, _, err := k.AddKeyRefWait(ctx, "fail")
+	if err != dialErr || ref != nil {
+		t.Fatalf("expected dial error but got: %v", err)
+	}
+	if _, ok := k.GetKey("fail"); ok {
+		t.Fatal("expected failed key to be released")
+	}
+}
+
+// TestWatchKeyRefs tests reconciling key references with a Watchable.
+func TestWatchKeyRefs(t *testing.T) {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+
+	k := NewKeyedRefCount(func(key string) (Routine, *testData) {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			return context.Canceled
+		}, &testData{}
+	})
+	k.SetContext(ctx, false)
+
+	ctr := ccontainer.NewCContainer(&[]string{"a", "b"})
+	watchCtx, watchCtxCancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WatchKeyRefs(watchCtx, k, ctr, func(val *[]string) []string {
+			return *val
+		}, time.Millisecond*10, 0, nil)
+	}()
+
+	waitKeys := func(expected ...string) {
+		t.Helper()
+		for range 100 {
+			keys := k.GetKeys()
+			slices.Sort(keys)
+			if slices.Equal(keys, expected) {
+				return
+			}
+			<-time.After(time.Millisecond * 10)
+		}
+		t.Fatalf("expected keys %v but got %v", expected, k.GetKeys())
+	}
+
+	waitKeys("a", "b")
+
+	// rapid changes are debounced to the last value
+	ctr.SetValue(&[]string{"c"})
+	ctr.SetValue(&[]string{"b", "c"})
+	waitKeys("b", "c")
+
+	// the references are released when the watcher exits
+	watchCtxCancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected context canceled but got %v", err)
+	}
+	waitKeys()
+}
+
+// TestWatchKeys_MaxDelay tests syncing a continuously changing value.
+func TestWatchKeys_MaxDelay(t *testing.T) {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+
+	k := NewKeyed(func(key int) (Routine, *testData) {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			return context.Canceled
+		}, &testData{}
+	})
+	k.SetContext(ctx, false)
+
+	ctr := ccontainer.NewCContainer(0)
+	go func() {
+		_ = WatchKeys(ctx, k, ctr, func(val int) []int {
+			return []int{val}
+		}, time.Millisecond*50, time.Millisecond*100, nil)
+	}()
+
+	// change the value more often than the quiet period
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	deadline := time.Now().Add(time.Second)
+	for i := 1; ; i++ {
+		<-ticker.C
+		ctr.SetValue(i)
+		if keys := k.GetKeys(); len(keys) == 1 && keys[0] > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected keys to sync within the max delay: %v", k.GetKeys())
+		}
+	}
+}
+
+// TestKeyedWithHeartbeat tests restarting a keyed routine which stops sending heartbeats.
+func TestKeyedWithHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	errCh := make(chan error, 10)
+	var runs atomic.Int32
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				if runs.Add(1) == 1 {
+					// stop sending heartbeats
+					<-ctx.Done()
+					return context.Canceled
+				}
+				for {
+					routine.Heartbeat(ctx)
+					select {
+					case <-ctx.Done():
+						return context.Canceled
+					case <-time.After(time.Millisecond * 10):
+					}
+				}
+			}, &testData{}
+		},
+		WithHeartbeat[string, *testData](time.Millisecond*50),
+		WithExitCb(func(key string, routine Routine, data *testData, err error) {
+			errCh <- err
+		}),
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_EXPONENTIAL,
+			Exponential: &backoff.Exponential{
+				InitialInterval: 10,
+				MaxInterval:     50,
+			},
+		}),
+	)
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test-key", true)
+
+	select {
+	case err := <-errCh:
+		if err != routine.ErrStalled {
+			t.Fatalf("expected stalled error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected routine to stall")
+	}
+
+	// the restarted routine sends heartbeats and keeps running
+	<-time.After(time.Millisecond * 200)
+	if n := runs.Load(); n != 2 {
+		t.Fatalf("expected 2 runs but got %d", n)
+	}
+	select {
+	case err := <-errCh:
+		t.Fatalf("unexpected exit: %v", err)
+	default:
+	}
+	k.ClearContext()
+}
+
+// TestKeyedWithHeartbeatReleasesSlot tests that a deadlocked routine releases
+// its concurrency slot when it stalls.
+func TestKeyedWithHeartbeatReleasesSlot(t *testing.T) {
+	ctx := context.Background()
+	stuck := make(chan struct{})
+	defer close(stuck)
+	restarted := make(chan struct{}, 1)
+	var runs atomic.Int32
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				if runs.Add(1) == 1 {
+					// deadlocked: ignores the context
+					<-stuck
+					return nil
+				}
+				select {
+				case restarted <- struct{}{}:
+				default:
+				}
+				for {
+					routine.Heartbeat(ctx)
+					select {
+					case <-ctx.Done():
+						return context.Canceled
+					case <-time.After(time.Millisecond * 10):
+					}
+				}
+			}, &testData{}
+		},
+		WithHeartbeat[string, *testData](time.Millisecond*50),
+		WithMaxConcurrency[string, *testData](1),
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_CONSTANT,
+			Constant:    &backoff.Constant{Interval: 10},
+		}),
+	)
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test-key", true)
+
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("expected stalled routine to be restarted in its slot")
+	}
+	k.ClearContext()
+}
+
+// TestKeyedWithHeartbeatShutdown tests that Shutdown waits for the goroutine
+// of a stalled routine to return.
+func TestKeyedWithHeartbeatShutdown(t *testing.T) {
+	stuck := make(chan struct{})
+	exited := make(chan error, 1)
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				// deadlocked: ignores the context
+				<-stuck
+				return nil
+			}, &testData{}
+		},
+		WithHeartbeat[string, *testData](time.Millisecond*20),
+		WithExitCb(func(key string, routine Routine, data *testData, err error) {
+			exited <- err
+		}),
+	)
+	k.SetContext(context.Background(), false)
+	_, _ = k.SetKey("test-key", true)
+
+	select {
+	case err := <-exited:
+		if err != routine.ErrStalled {
+			t.Fatalf("expected ErrStalled but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected routine to stall")
+	}
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer ctxCancel()
+	if err := k.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Shutdown to wait for the stalled routine but got %v", err)
+	}
+
+	close(stuck)
+	ctx, ctxCancel = context.WithTimeout(context.Background(), time.Second)
+	defer ctxCancel()
+	if err := k.WaitAllExited(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// TestKeyedWithPanicRecovery tests retrying a keyed routine which panics.
+func TestKeyedWithPanicRecovery(t *testing.T) {
+	ctx := context.Background()
+	errCh := make(chan error, 10)
+	var runs atomic.Int32
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			return func(ctx context.Context) error {
+				if runs.Add(1) == 1 {
+					panic("test panic")
+				}
+				return nil
+			}, &testData{}
+		},
+		WithPanicRecovery[string, *testData](),
+		WithExitCb(func(key string, routine Routine, data *testData, err error) {
+			errCh <- err
+		}),
+		WithRetry[string, *testData](&backoff.Backoff{
+			BackoffKind: backoff.BackoffKind_BackoffKind_EXPONENTIAL,
+			Exponential: &backoff.Exponential{
+				InitialInterval: 10,
+				MaxInterval:     50,
+			},
+		}),
+	)
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test-key", true)
+
+	var perr *panics.PanicError
+	if err := <-errCh; !errors.As(err, &perr) || perr.Value != "test panic" {
+		t.Fatalf("expected panic error but got %v", err)
+	}
+	// expect the routine to be retried
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected retry to succeed but got %v", err)
+	}
+}
+
+// TestKeyedWithExitHistory tests the per-key exit history.
+func TestKeyedWithExitHistory(t *testing.T) {
+	ctx := context.Background()
+	startedCh := make(chan struct{}, 10)
+	errBoom := errors.New("boom")
+	k := NewKeyed(
+		func(key string) (Routine, *testData) {
+			if key == "fail-key" {
+				return func(ctx context.Context) error {
+					return errBoom
+				}, &testData{}
+			}
+			return func(ctx context.Context) error {
+				startedCh <- struct{}{}
+				<-ctx.Done()
+				return context.Canceled
+			}, &testData{}
+		},
+		WithExitHistory[string, *testData](5),
+	)
+	k.SetContext(ctx, false)
+	_, _ = k.SetKey("test-key", true)
+	<-startedCh
+
+	if _, reset := k.RestartRoutine("test-key"); !reset {
+		t.Fatal("expected restart")
+	}
+	<-startedCh
+	if _, reset := k.ResetRoutine("test-key"); !reset {
+		t.Fatal("expected reset")
+	}
+	<-startedCh
+
+	// the previous run records its exit after the next run starts
+	var records []routine.ExitRecord
+	for range 100 {
+		var ok bool
+		records, ok = k.GetExitHistory("test-key")
+		if !ok || len(records) >= 2 {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records but got %d", len(records))
+	}
+	for _, rec := range records {
+		if !rec.Canceled || rec.Failed() {
+			t.Fatalf("expected record to be canceled: %v", rec)
+		}
+	}
+	if _, ok := k.GetExitHistory("other-key"); ok {
+		t.Fatal("expected unknown key to not exist")
+	}
+
+	// a routine returning an error is recorded as failed
+	_, _ = k.SetKey("fail-key", true)
+	records = nil
+	for range 100 {
+		records, _ = k.GetExitHistory("fail-key")
+		if len(records) != 0 {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record but got %d", len(records))
+	}
+	if rec := records[0]; rec.Canceled || !rec.Failed() || rec.Err != errBoom {
+		t.Fatalf("expected record to be failed: %v", rec)
+	}
+	k.ClearContext()
+}
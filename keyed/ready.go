@@ -0,0 +1,98 @@
+package keyed
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrExitedBeforeReady is returned if a routine exits or is removed before it is ready.
+var ErrExitedBeforeReady = errors.New("routine exited before ready")
+
+// ReadyRoutine is a Routine which reports when it has finished setting up.
+//
+// ready should be called once the routine is ready with the ready value.
+// Only the first call to ready in each run of the routine is used.
+// If nil is returned, exits cleanly permanently.
+// If an error is returned, can be restarted later.
+type ReadyRoutine[V any] func(ctx context.Context, ready func(val V)) error
+
+// NewKeyedWithReady constructs a new Keyed execution manager with ReadyRoutine.
+//
+// The V returned by the constructor is the key data. The value passed to ready
+// is returned by WaitKeyReady.
+//
+// Note: routines won't start until SetContext is called.
+func NewKeyedWithReady[K comparable, V any](
+	ctorCb func(key K) (ReadyRoutine[V], V),
+	opts ...Option[K, V],
+) *Keyed[K, V] {
+	k := NewKeyed[K, V](nil, opts...)
+	if ctorCb != nil {
+		k.readyCtorCb = ctorCb
+	}
+	return k
+}
+
+// NewKeyedRefCountWithReady constructs a new KeyedRefCount with ReadyRoutine.
+//
+// The V returned by the constructor is the key data. The value passed to ready
+// is returned by AddKeyRefWait.
+//
+// Note: routines won't start until SetContext is called.
+func NewKeyedRefCountWithReady[K comparable, V any](
+	ctorCb func(key K) (ReadyRoutine[V], V),
+	opts ...Option[K, V],
+) *KeyedRefCount[K, V] {
+	return newKeyedRefCount(NewKeyedWithReady(ctorCb, opts...))
+}
+
+// WaitKeyReady waits for the routine for the key to be ready.
+//
+// Returns the value passed to ready. Routines which are not a ReadyRoutine
+// are ready once started and return the key data.
+// Returns the routine error or ErrExitedBeforeReady if the routine exits or
+// the key is removed before the routine is ready.
+// Returns context.Canceled if ctx is canceled.
+func (k *Keyed[K, V]) WaitKeyReady(ctx context.Context, key K) (V, error) {
+	var empty V
+	for {
+		k.mtx.Lock()
+		v, existed := k.routines[key]
+		if !existed {
+			k.mtx.Unlock()
+			return empty, ErrExitedBeforeReady
+		}
+		if v.ready {
+			val := v.readyVal
+			k.mtx.Unlock()
+			return val, nil
+		}
+		if v.exited {
+			err := v.err
+			k.mtx.Unlock()
+			if err == nil {
+				err = ErrExitedBeforeReady
+			}
+			return empty, err
+		}
+		if k.stateCh == nil {
+			k.stateCh = make(chan struct{})
+		}
+		waitCh := k.stateCh
+		k.mtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return empty, context.Canceled
+		case <-waitCh:
+		}
+	}
+}
+
+// setReadyLocked marks the routine as ready with the value.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) setReadyLocked(val V) {
+	r.ready, r.readyVal = true, val
+	r.k.emitLocked(EventReady, r.key, nil, 0)
+	r.k.notifyStateLocked()
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/aperturerobotics/util/backoff"
 	cbackoff "github.com/aperturerobotics/util/backoff/cbackoff"
+	"github.com/aperturerobotics/util/routine"
 )
 
 // runningRoutine tracks a running routine
@@ -26,14 +27,27 @@ type runningRoutine[K comparable, V any] struct {
 	exitedCh <-chan struct{}
 	// routine is the routine callback
 	routine Routine
+	// readyRoutine is the ready routine callback, if any.
+	// if set, called instead of routine.
+	readyRoutine ReadyRoutine[V]
 	// data is the associated routine data
 	data V
+	// ready indicates the routine reported it is ready.
+	ready bool
+	// readyVal is the value passed to ready.
+	readyVal V
 	// err is the error if any
 	err error
 	// success indicates the routine succeeded
 	success bool
 	// exited indicates the routine exited
 	exited bool
+	// lastErr is the error from the last exit, kept across restarts.
+	lastErr error
+	// startCount is the number of times the routine was started.
+	startCount int
+	// lastStarted is the time the routine was last started.
+	lastStarted time.Time
 
 	// deferRemove is set if we are waiting to remove this.
 	deferRemove *time.Timer
@@ -42,6 +56,21 @@ type runningRoutine[K comparable, V any] struct {
 	retryBo cbackoff.BackOff
 	// deferRetry is set if we are waiting to retry this.
 	deferRetry *time.Timer
+	// nextRetry is when deferRetry will fire.
+	nextRetry time.Time
+
+	// queued indicates we are waiting for a concurrency slot.
+	queued bool
+	// queueSeq is incremented each time the routine is queued.
+	queueSeq uint64
+	// queuedWaitCh is the waitCh to pass to execute once started.
+	queuedWaitCh <-chan struct{}
+
+	// breaker is the circuit breaker state
+	// if nil, the circuit breaker is disabled
+	breaker *circuitBreaker
+	// exitHistory is the history of runs, if enabled.
+	exitHistory *routine.ExitHistory
 }
 
 // newRunningRoutine constructs a new runningRoutine
@@ -56,12 +85,18 @@ func newRunningRoutine[K comparable, V any](
 	if backoffFactory != nil {
 		backoff = backoffFactory(key)
 	}
+	var breaker *circuitBreaker
+	if k.breakerConf != nil {
+		breaker = &circuitBreaker{}
+	}
 	return &runningRoutine[K, V]{
-		k:       k,
-		key:     key,
-		routine: routine,
-		data:    data,
-		retryBo: backoff,
+		k:           k,
+		key:         key,
+		routine:     routine,
+		data:        data,
+		retryBo:     backoff,
+		breaker:     breaker,
+		exitHistory: k.newExitHistory(),
 	}
 }
 
@@ -73,6 +108,14 @@ func (r *runningRoutine[K, V]) start(ctx context.Context, waitCh <-chan struct{}
 	if (!forceRestart && r.success) || r.routine == nil {
 		return
 	}
+	if r.queued {
+		// routine is waiting for a concurrency slot
+		return
+	}
+	if r.breaker != nil && r.breaker.state == BreakerOpen {
+		// routine is parked by the circuit breaker
+		return
+	}
 	if !forceRestart && r.ctx != nil && !r.exited && r.ctx.Err() == nil {
 		// routine is still running
 		return
@@ -89,11 +132,40 @@ func (r *runningRoutine[K, V]) start(ctx context.Context, waitCh <-chan struct{}
 		// root context is canceled or nil, don't retry.
 		return
 	}
+	if !r.k.tryAcquireSlotLocked() {
+		// wait for a concurrency slot
+		r.ctx, r.ctxCancel = nil, nil
+		r.err = nil
+		r.success, r.exited = false, false
+		r.queued = true
+		r.queueSeq++
+		r.queuedWaitCh = waitCh
+		r.k.startQueue.Push(queuedRoutine[K, V]{r: r, seq: r.queueSeq})
+		r.k.emitLocked(EventQueued, r.key, nil, 0)
+		r.k.startQueuedLocked()
+		return
+	}
+	r.launch(ctx, waitCh)
+}
+
+// launch starts the routine goroutine.
+// expects k.mtx to be locked by caller and a concurrency slot to be held.
+func (r *runningRoutine[K, V]) launch(ctx context.Context, waitCh <-chan struct{}) {
 	exitedCh := make(chan struct{})
 	r.err = nil
 	r.success, r.exited = false, false
 	r.exitedCh = exitedCh
 	r.ctx, r.ctxCancel = context.WithCancel(ctx)
+	r.startCount++
+	r.lastStarted = time.Now()
+	r.k.live++
+	r.k.emitLocked(EventStarted, r.key, nil, 0)
+	var empty V
+	r.ready, r.readyVal = false, empty
+	if r.readyRoutine == nil {
+		// plain routines are ready once started
+		r.setReadyLocked(r.data)
+	}
 	go r.execute(r.ctx, r.ctxCancel, exitedCh, waitCh)
 }
 
@@ -115,44 +187,133 @@ func (r *runningRoutine[K, V]) execute(
 		err = context.Canceled
 	}
 
+	exec := routine.NewExecution(r.k.heartbeat, r.k.recoverPanics)
+	// slotReleased is set when the concurrency slot was released, guarded by k.mtx
+	var slotReleased bool
 	if err == nil {
-		err = r.routine(ctx)
+		err = exec.Run(ctx, func(rctx context.Context) error {
+			if r.readyRoutine != nil {
+				return r.readyRoutine(rctx, func(val V) {
+					r.k.mtx.Lock()
+					if r.ctx == ctx && !r.ready && !exec.Handled() {
+						r.setReadyLocked(val)
+					}
+					r.k.mtx.Unlock()
+				})
+			}
+			return r.routine(rctx)
+		}, func() {
+			// mark the routine as exited without waiting for it to return
+			r.k.mtx.Lock()
+			// release the slot so the stuck goroutine cannot starve the queue
+			if !slotReleased {
+				slotReleased = true
+				r.k.releaseSlotLocked()
+			}
+			exitedCb := r.exitedLocked(ctx, exec.Started(), routine.ErrStalled, ctx.Err() != nil)
+			r.k.mtx.Unlock()
+			if exitedCb != nil {
+				exitedCb()
+			}
+		})
 	}
+	// check before canceling the run context below
+	canceled := ctx.Err() != nil
 	cancel()
 	close(exitedCh)
 
 	r.k.mtx.Lock()
-	if r.ctx == ctx {
-		r.err = err
-		r.success = err == nil
-		r.exited = true
-		r.exitedCh = nil
-		if r.retryBo != nil {
-			if r.deferRetry != nil {
-				r.deferRetry.Stop()
-				r.deferRetry = nil
-			}
-			if r.success {
-				r.retryBo.Reset()
-			} else if r.k.routines[r.key] == r && r.k.ctx != nil && r.k.ctx.Err() == nil {
-				dur := r.retryBo.NextBackOff()
-				if dur != backoff.Stop {
-					r.deferRetry = time.AfterFunc(dur, func() {
-						r.k.mtx.Lock()
-						if r.k.ctx != nil && r.k.routines[r.key] == r && r.exited && r.k.ctx.Err() == nil {
-							r.start(r.k.ctx, r.exitedCh, true)
-						}
-						r.k.mtx.Unlock()
-					})
-				}
+	if !slotReleased {
+		slotReleased = true
+		r.k.releaseSlotLocked()
+	}
+	r.k.live--
+	if r.k.live == 0 && r.k.idleCh != nil {
+		close(r.k.idleCh)
+		r.k.idleCh = nil
+	}
+	r.k.collectExitLocked(r.key, err)
+	var exitedCb func()
+	if exec.Handle() {
+		exitedCb = r.exitedLocked(ctx, exec.Started(), err, canceled)
+	}
+	r.k.mtx.Unlock()
+	if exitedCb != nil {
+		exitedCb()
+	}
+}
+
+// exitedLocked marks the routine running with ctx as exited with err.
+// canceled indicates ctx was canceled before the routine exited.
+// Returns a function to call the exited callbacks after unlocking mtx, or nil.
+// expects k.mtx to be locked by caller
+func (r *runningRoutine[K, V]) exitedLocked(ctx context.Context, started time.Time, err error, canceled bool) func() {
+	var delay time.Duration
+	if r.exitHistory != nil {
+		defer func() {
+			r.exitHistory.Push(routine.NewExitRecord(started, err, canceled, delay))
+		}()
+	}
+	if r.ctx != ctx {
+		return nil
+	}
+	r.err = err
+	r.success = err == nil
+	r.exited = true
+	r.exitedCh = nil
+	r.lastErr = err
+	var empty V
+	r.ready, r.readyVal = false, empty
+	r.k.notifyStateLocked()
+	r.k.emitLocked(EventExited, r.key, err, 0)
+	var parked bool
+	if r.breaker != nil && r.k.routines[r.key] == r && r.k.ctx != nil && r.k.ctx.Err() == nil {
+		parked = r.recordBreakerExitLocked(err)
+	}
+	if r.retryBo != nil && !parked {
+		if r.deferRetry != nil {
+			r.deferRetry.Stop()
+			r.deferRetry = nil
+		}
+		if r.success {
+			r.retryBo.Reset()
+		} else if r.k.routines[r.key] == r && r.k.ctx != nil && r.k.ctx.Err() == nil {
+			dur := r.retryBo.NextBackOff()
+			if dur != backoff.Stop {
+				delay = dur
+				var retryTimer *time.Timer
+				retryTimer = time.AfterFunc(dur, func() {
+					r.k.mtx.Lock()
+					if r.deferRetry == retryTimer {
+						r.deferRetry = nil
+					}
+					if r.k.ctx != nil && r.k.routines[r.key] == r && r.exited && r.k.ctx.Err() == nil {
+						r.k.emitLocked(EventRetry, r.key, nil, 0)
+						r.start(r.k.ctx, r.exitedCh, true)
+					}
+					r.k.mtx.Unlock()
+				})
+				r.deferRetry = retryTimer
+				r.nextRetry = time.Now().Add(dur)
+				r.k.emitLocked(EventBackoff, r.key, err, dur)
 			}
 		}
-		for i := len(r.k.exitedCbs) - 1; i >= 0; i-- {
-			// run after unlocking mtx
-			defer (r.k.exitedCbs[i])(r.key, r.routine, r.data, r.err)
+	}
+	rt, data := r.routine, r.data
+	return func() {
+		for _, cb := range r.k.exitedCbs {
+			cb(r.key, rt, data, err)
 		}
 	}
-	r.k.mtx.Unlock()
+}
+
+// dequeue removes the routine from the start queue, if queued.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) dequeue() {
+	if r.queued {
+		r.queued = false
+		r.queuedWaitCh = nil
+	}
 }
 
 // remove is called when the routine is removed / canceled.
@@ -165,14 +326,18 @@ func (r *runningRoutine[K, V]) remove() {
 		if r.ctxCancel != nil {
 			r.ctxCancel()
 		}
+		r.dequeue()
+		r.stopBreakerLocked()
 		if r.deferRetry != nil {
 			// cancel retrying this key
 			_ = r.deferRetry.Stop()
 			r.deferRetry = nil
 		}
 		delete(r.k.routines, r.key)
+		r.k.emitLocked(EventRemoved, r.key, nil, 0)
+		r.k.notifyStateLocked()
 	}
-	if r.k.releaseDelay == 0 || (r.exited && !r.success) {
+	if r.k.releaseDelay == 0 || r.queued || (r.exited && !r.success) {
 		removeNow()
 		return
 	}
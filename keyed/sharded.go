@@ -0,0 +1,315 @@
+package keyed
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"runtime"
+	"sync"
+
+	"github.com/aperturerobotics/util/routine"
+	"github.com/sirupsen/logrus"
+)
+
+// ShardedKeyed manages a set of goroutines with associated Keys.
+//
+// Keys are partitioned by hash into a set of Keyed shards, each with their own
+// lock. This reduces lock contention with very large key sets and many
+// goroutines calling SetKey and RemoveKey concurrently.
+//
+// Options apply to each shard individually: for example WithMaxConcurrency
+// limits the number of running routines per shard, and event sequence numbers
+// are incremented per shard.
+type ShardedKeyed[K comparable, V any] struct {
+	// seed is the hash seed
+	seed maphash.Seed
+	// shards is the list of shards
+	shards []*Keyed[K, V]
+}
+
+// NewShardedKeyed constructs a new ShardedKeyed execution manager.
+//
+// If shardCount <= 0, uses runtime.GOMAXPROCS(0) shards.
+// Note: routines won't start until SetContext is called.
+func NewShardedKeyed[K comparable, V any](
+	shardCount int,
+	ctorCb func(key K) (Routine, V),
+	opts ...Option[K, V],
+) *ShardedKeyed[K, V] {
+	return newShardedKeyed(shardCount, func() *Keyed[K, V] {
+		return NewKeyed(ctorCb, opts...)
+	})
+}
+
+// NewShardedKeyedWithLogger constructs a new ShardedKeyed instance.
+// Logs when a controller exits without being removed from the Keys set.
+//
+// If shardCount <= 0, uses runtime.GOMAXPROCS(0) shards.
+// Note: routines won't start until SetContext is called.
+func NewShardedKeyedWithLogger[K comparable, V any](
+	shardCount int,
+	ctorCb func(key K) (Routine, V),
+	le *logrus.Entry,
+	opts ...Option[K, V],
+) *ShardedKeyed[K, V] {
+	return newShardedKeyed(shardCount, func() *Keyed[K, V] {
+		return NewKeyedWithLogger(ctorCb, le, opts...)
+	})
+}
+
+// newShardedKeyed constructs the shards with the constructor.
+func newShardedKeyed[K comparable, V any](shardCount int, ctor func() *Keyed[K, V]) *ShardedKeyed[K, V] {
+	if shardCount <= 0 {
+		shardCount = runtime.GOMAXPROCS(0)
+	}
+	k := &ShardedKeyed[K, V]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*Keyed[K, V], shardCount),
+	}
+	for i := range k.shards {
+		k.shards[i] = ctor()
+	}
+	return k
+}
+
+// shardIndex returns the index of the shard for the key.
+func (k *ShardedKeyed[K, V]) shardIndex(key K) int {
+	if len(k.shards) == 1 {
+		return 0
+	}
+	return int(maphash.Comparable(k.seed, key) % uint64(len(k.shards)))
+}
+
+// shard returns the shard for the key.
+func (k *ShardedKeyed[K, V]) shard(key K) *Keyed[K, V] {
+	return k.shards[k.shardIndex(key)]
+}
+
+// SetContext updates the root context, restarting all running routines.
+//
+// nil context is valid and will shutdown the routines.
+// if restart is true, all errored routines also restart
+func (k *ShardedKeyed[K, V]) SetContext(ctx context.Context, restart bool) {
+	for _, shard := range k.shards {
+		shard.SetContext(ctx, restart)
+	}
+}
+
+// ClearContext clears the context and shuts down any running routines.
+func (k *ShardedKeyed[K, V]) ClearContext() {
+	k.SetContext(nil, false)
+}
+
+// GetKeys returns the list of keys registered with the ShardedKeyed instance.
+func (k *ShardedKeyed[K, V]) GetKeys() []K {
+	var keys []K
+	for _, shard := range k.shards {
+		keys = append(keys, shard.GetKeys()...)
+	}
+	return keys
+}
+
+// GetKeysWithData returns the keys and the data for the keys.
+func (k *ShardedKeyed[K, V]) GetKeysWithData() []KeyWithData[K, V] {
+	var out []KeyWithData[K, V]
+	for _, shard := range k.shards {
+		out = append(out, shard.GetKeysWithData()...)
+	}
+	return out
+}
+
+// SetKey inserts the given key into the set, if it doesn't already exist.
+// If start=true, restarts the routine from any stopped or failed state.
+// Returns if it existed already or not.
+func (k *ShardedKeyed[K, V]) SetKey(key K, start bool) (V, bool) {
+	return k.shard(key).SetKey(key, start)
+}
+
+// RemoveKey removes the given key from the set, if it exists.
+// Returns if it existed.
+func (k *ShardedKeyed[K, V]) RemoveKey(key K) bool {
+	return k.shard(key).RemoveKey(key)
+}
+
+// SyncKeys synchronizes the list of running routines with the given list.
+// If restart=true, restarts any routines in the failed state.
+//
+// The shards are synced one at a time, so the update is not atomic across
+// shards: concurrent readers may observe some shards already synced while
+// others still hold the previous keys, and concurrent SetKey or RemoveKey
+// calls may interleave with the sync.
+//
+// The added keys are returned in the order they appear in keys.
+func (k *ShardedKeyed[K, V]) SyncKeys(keys []K, restart bool) (added, removed []K) {
+	shardKeys := make([][]K, len(k.shards))
+	for _, key := range keys {
+		idx := k.shardIndex(key)
+		shardKeys[idx] = append(shardKeys[idx], key)
+	}
+
+	var addedSet map[K]struct{}
+	for i, shard := range k.shards {
+		shardAdded, shardRemoved := shard.SyncKeys(shardKeys[i], restart)
+		removed = append(removed, shardRemoved...)
+		if len(shardAdded) != 0 {
+			if addedSet == nil {
+				addedSet = make(map[K]struct{}, len(shardAdded))
+			}
+			for _, key := range shardAdded {
+				addedSet[key] = struct{}{}
+			}
+		}
+	}
+
+	// return the added keys in the same order as Keyed.SyncKeys
+	if len(addedSet) != 0 {
+		added = make([]K, 0, len(addedSet))
+		for _, key := range keys {
+			if _, ok := addedSet[key]; ok {
+				delete(addedSet, key)
+				added = append(added, key)
+			}
+		}
+	}
+	return added, removed
+}
+
+// GetKey returns the value for the given key and existed.
+func (k *ShardedKeyed[K, V]) GetKey(key K) (V, bool) {
+	return k.shard(key).GetKey(key)
+}
+
+// ResetRoutine resets the given routine after checking the condition functions.
+// If any of the conds functions return true, resets the instance.
+//
+// Resetting the instance constructs a new Routine and data with the constructor.
+// Note: this will overwrite the existing Data, if present!
+// In most cases RestartRoutine is actually what you want.
+//
+// If len(conds) == 0, always resets the given key.
+func (k *ShardedKeyed[K, V]) ResetRoutine(key K, conds ...func(K, V) bool) (existed bool, reset bool) {
+	return k.shard(key).ResetRoutine(key, conds...)
+}
+
+// ResetAllRoutines resets all routines after checking the condition functions.
+// If any of the conds functions return true for an instance, resets the instance.
+//
+// If len(conds) == 0, always resets the keys.
+func (k *ShardedKeyed[K, V]) ResetAllRoutines(conds ...func(K, V) bool) (resetCount, totalCount int) {
+	for _, shard := range k.shards {
+		shardReset, shardTotal := shard.ResetAllRoutines(conds...)
+		resetCount += shardReset
+		totalCount += shardTotal
+	}
+	return
+}
+
+// RestartRoutine restarts the given routine after checking the condition functions.
+// If any return true, and the routine is running, restarts the instance.
+//
+// If len(conds) == 0, always resets the given key.
+func (k *ShardedKeyed[K, V]) RestartRoutine(key K, conds ...func(K, V) bool) (existed bool, reset bool) {
+	return k.shard(key).RestartRoutine(key, conds...)
+}
+
+// RestartAllRoutines restarts all routines after checking the condition functions.
+// If any return true, and the routine is running, restarts the instance.
+//
+// If len(conds) == 0, always resets the keys.
+func (k *ShardedKeyed[K, V]) RestartAllRoutines(conds ...func(K, V) bool) (restartedCount, totalCount int) {
+	for _, shard := range k.shards {
+		shardRestarted, shardTotal := shard.RestartAllRoutines(conds...)
+		restartedCount += shardRestarted
+		totalCount += shardTotal
+	}
+	return
+}
+
+// GetKeyStatus returns a snapshot of the status for the given key.
+// Returns false if the key does not exist.
+func (k *ShardedKeyed[K, V]) GetKeyStatus(key K) (KeyStatus[K], bool) {
+	return k.shard(key).GetKeyStatus(key)
+}
+
+// GetExitHistory returns the recent runs of the routine for the key from
+// oldest to newest.
+// Returns false if the key does not exist.
+func (k *ShardedKeyed[K, V]) GetExitHistory(key K) ([]routine.ExitRecord, bool) {
+	return k.shard(key).GetExitHistory(key)
+}
+
+// GetAllStatuses returns a snapshot of the status of all keys.
+func (k *ShardedKeyed[K, V]) GetAllStatuses() []KeyStatus[K] {
+	var out []KeyStatus[K]
+	for _, shard := range k.shards {
+		out = append(out, shard.GetAllStatuses()...)
+	}
+	return out
+}
+
+// ResetCircuitBreaker closes the circuit breaker for the given key.
+// Returns false if the key does not exist or the circuit breaker is not enabled.
+func (k *ShardedKeyed[K, V]) ResetCircuitBreaker(key K) bool {
+	return k.shard(key).ResetCircuitBreaker(key)
+}
+
+// WaitKeyReady waits for the routine for the key to be ready.
+//
+// Returns the key data once the routine has started.
+// Returns the routine error or ErrExitedBeforeReady if the routine exits or
+// the key is removed before the routine is ready.
+// Returns context.Canceled if ctx is canceled.
+func (k *ShardedKeyed[K, V]) WaitKeyReady(ctx context.Context, key K) (V, error) {
+	return k.shard(key).WaitKeyReady(ctx, key)
+}
+
+// SubscribeEvents adds a callback for key lifecycle events on all shards.
+//
+// Events for the same key are delivered in order. Seq is incremented per
+// shard. The callback is called with the shard mutex locked: it must not
+// block or call any methods on the ShardedKeyed.
+// Returns a function to cancel the subscription.
+func (k *ShardedKeyed[K, V]) SubscribeEvents(cb func(ev Event[K])) (cancel func()) {
+	cancels := make([]func(), len(k.shards))
+	for i, shard := range k.shards {
+		cancels[i] = shard.SubscribeEvents(cb)
+	}
+	return func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+// WaitAllExited waits for all running routines to return.
+//
+// Does not cancel the routines: use Shutdown to cancel and wait.
+// Returns context.Canceled if ctx is canceled.
+func (k *ShardedKeyed[K, V]) WaitAllExited(ctx context.Context) error {
+	for _, shard := range k.shards {
+		if err := shard.WaitAllExited(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown clears the context and waits for all routines to return.
+//
+// Returns a joined error of RoutineError for each routine that failed, either
+// before or during the shutdown. context.Canceled errors returned by the
+// routines are ignored. If ctx is canceled before all routines exited,
+// context.Canceled is also joined.
+//
+// The keys are kept: calling SetContext again restarts the routines.
+func (k *ShardedKeyed[K, V]) Shutdown(ctx context.Context) error {
+	errs := make([]error, len(k.shards))
+	var wg sync.WaitGroup
+	for i, shard := range k.shards {
+		wg.Go(func() {
+			errs[i] = shard.Shutdown(ctx)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,122 @@
+package keyed
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// TestShardedKeyed tests the sharded keyed goroutine manager.
+func TestShardedKeyed(t *testing.T) {
+	ctx := context.Background()
+	vals := make(chan string, 10)
+	k := NewShardedKeyed(4, func(key string) (Routine, *testData) {
+		return func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return context.Canceled
+			case vals <- key:
+				return nil
+			}
+		}, &testData{value: key}
+	})
+
+	nsend := 101
+	keys := make([]string, nsend)
+	for i := range nsend {
+		keys[i] = "routine-" + strconv.Itoa(i)
+	}
+
+	added, removed := k.SyncKeys(keys, false)
+	if len(removed) != 0 || !slices.Equal(added, keys) {
+		t.Fatalf("unexpected sync result: added %v removed %v", added, removed)
+	}
+
+	nsend--
+	added, removed = k.SyncKeys(keys[:nsend], false)
+	if len(added) != 0 || !slices.Equal(removed, keys[nsend:]) {
+		t.Fatalf("unexpected sync result: added %v removed %v", added, removed)
+	}
+	keys = keys[:nsend]
+
+	gotKeys := k.GetKeys()
+	slices.Sort(gotKeys)
+	sortedKeys := slices.Clone(keys)
+	slices.Sort(sortedKeys)
+	if !slices.Equal(gotKeys, sortedKeys) {
+		t.Fatalf("unexpected keys: %v", gotKeys)
+	}
+	if data, ok := k.GetKey(keys[5]); !ok || data.value != keys[5] {
+		t.Fatalf("unexpected data for key: %v", data)
+	}
+
+	k.SetContext(ctx, false)
+	seen := make(map[string]struct{})
+	for len(seen) != nsend {
+		val := <-vals
+		if _, ok := seen[val]; ok {
+			t.Fatalf("duplicate value: %s", val)
+		}
+		seen[val] = struct{}{}
+	}
+
+	if err := k.Shutdown(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// benchmarkSetRemoveKeys benchmarks concurrent SetKey and RemoveKey churn.
+//
+// The keys are started, so each iteration starts and stops a routine.
+func benchmarkSetRemoveKeys(b *testing.B, setKey func(key int), removeKey func(key int)) {
+	const nkeys = 10000
+	for i := range nkeys {
+		setKey(i)
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := nkeys + int(next.Add(1))
+			setKey(key)
+			removeKey(key)
+		}
+	})
+}
+
+// BenchmarkKeyed_SetRemoveKeys benchmarks key churn with a single lock.
+func BenchmarkKeyed_SetRemoveKeys(b *testing.B) {
+	k := NewKeyed(func(key int) (Routine, struct{}) {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, struct{}{}
+	})
+	k.SetContext(b.Context(), false)
+	defer k.ClearContext()
+	benchmarkSetRemoveKeys(
+		b,
+		func(key int) { _, _ = k.SetKey(key, true) },
+		func(key int) { _ = k.RemoveKey(key) },
+	)
+}
+
+// BenchmarkShardedKeyed_SetRemoveKeys benchmarks key churn with sharded locks.
+func BenchmarkShardedKeyed_SetRemoveKeys(b *testing.B) {
+	k := NewShardedKeyed(0, func(key int) (Routine, struct{}) {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}, struct{}{}
+	})
+	k.SetContext(b.Context(), false)
+	defer k.ClearContext()
+	benchmarkSetRemoveKeys(
+		b,
+		func(key int) { _, _ = k.SetKey(key, true) },
+		func(key int) { _ = k.RemoveKey(key) },
+	)
+}
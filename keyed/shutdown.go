@@ -0,0 +1,104 @@
+package keyed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// RoutineError is an error returned by the routine for a key.
+type RoutineError[K comparable] struct {
+	// Key is the key of the routine.
+	Key K
+	// Err is the error returned by the routine.
+	Err error
+}
+
+// Error returns the error string.
+func (e *RoutineError[K]) Error() string {
+	return fmt.Sprintf("%v: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the error returned by the routine.
+func (e *RoutineError[K]) Unwrap() error {
+	return e.Err
+}
+
+// exitCollector collects routine errors while waiting for a shutdown.
+type exitCollector struct {
+	errs []error
+}
+
+// WaitAllExited waits for all running routines to return.
+//
+// Does not cancel the routines: use Shutdown to cancel and wait.
+// Routines waiting for a retry or a concurrency slot are not running.
+// Stalled routines are waited for until their goroutine returns.
+// Returns context.Canceled if ctx is canceled.
+func (k *Keyed[K, V]) WaitAllExited(ctx context.Context) error {
+	for {
+		k.mtx.Lock()
+		if k.live == 0 {
+			k.mtx.Unlock()
+			return nil
+		}
+		if k.idleCh == nil {
+			k.idleCh = make(chan struct{})
+		}
+		waitCh := k.idleCh
+		k.mtx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-waitCh:
+		}
+	}
+}
+
+// Shutdown clears the context and waits for all routines to return.
+//
+// Returns a joined error of RoutineError for each routine that failed, either
+// before or during the shutdown. context.Canceled errors returned by the
+// routines are ignored. If ctx is canceled before all routines exited,
+// context.Canceled is also joined.
+//
+// The keys are kept: calling SetContext again restarts the routines.
+func (k *Keyed[K, V]) Shutdown(ctx context.Context) error {
+	coll := &exitCollector{}
+	k.mtx.Lock()
+	for key, rr := range k.routines {
+		if rr.exited && rr.err != nil && rr.err != context.Canceled {
+			coll.errs = append(coll.errs, &RoutineError[K]{Key: key, Err: rr.err})
+		}
+	}
+	k.collectors = append(k.collectors, coll)
+	k.setContextLocked(nil, false)
+	k.mtx.Unlock()
+
+	waitErr := k.WaitAllExited(ctx)
+
+	k.mtx.Lock()
+	k.collectors = slices.DeleteFunc(k.collectors, func(c *exitCollector) bool {
+		return c == coll
+	})
+	errs := coll.errs
+	k.mtx.Unlock()
+
+	if waitErr != nil {
+		errs = append(errs, waitErr)
+	}
+	return errors.Join(errs...)
+}
+
+// collectExitLocked records the exit of a routine with any active collectors.
+// expects mtx to be locked by caller
+func (k *Keyed[K, V]) collectExitLocked(key K, err error) {
+	if err == nil || err == context.Canceled {
+		return
+	}
+	for _, coll := range k.collectors {
+		coll.errs = append(coll.errs, &RoutineError[K]{Key: key, Err: err})
+	}
+}
@@ -0,0 +1,128 @@
+package keyed
+
+import "time"
+
+// KeyState is the state of a key in a Keyed.
+type KeyState int
+
+const (
+	// KeyStateStopped indicates the routine is not running.
+	// This is the case if the context is not set or the routine is nil.
+	KeyStateStopped KeyState = iota
+	// KeyStateQueued indicates the routine is waiting for a concurrency slot.
+	KeyStateQueued
+	// KeyStateRunning indicates the routine is running.
+	KeyStateRunning
+	// KeyStateExited indicates the routine exited and will not be retried.
+	KeyStateExited
+	// KeyStateRetrying indicates the routine exited and is waiting on a retry timer.
+	KeyStateRetrying
+	// KeyStatePendingRelease indicates the key was removed and is waiting for
+	// the release delay before the routine is canceled.
+	KeyStatePendingRelease
+	// KeyStateParked indicates the circuit breaker is open and the routine is
+	// waiting for the cooldown before a probe run.
+	KeyStateParked
+)
+
+// String returns the name of the key state.
+func (s KeyState) String() string {
+	switch s {
+	case KeyStateStopped:
+		return "stopped"
+	case KeyStateQueued:
+		return "queued"
+	case KeyStateRunning:
+		return "running"
+	case KeyStateExited:
+		return "exited"
+	case KeyStateRetrying:
+		return "retrying"
+	case KeyStatePendingRelease:
+		return "pending-release"
+	case KeyStateParked:
+		return "parked"
+	default:
+		return "unknown"
+	}
+}
+
+// KeyStatus is a snapshot of the status of a key.
+type KeyStatus[K comparable] struct {
+	// Key is the key.
+	Key K
+	// State is the current state of the routine.
+	State KeyState
+	// LastErr is the error returned by the last exit of the routine, if any.
+	LastErr error
+	// RestartCount is the number of times the routine was started after the first.
+	RestartCount int
+	// LastStarted is when the routine was last started.
+	// Zero if the routine was never started.
+	LastStarted time.Time
+	// NextRetry is when the routine will be retried.
+	// If State is KeyStateParked, this is when the probe run is allowed.
+	// Zero if State is not KeyStateRetrying or KeyStateParked.
+	NextRetry time.Time
+	// Breaker is the circuit breaker state.
+	// Always BreakerClosed if the circuit breaker is not enabled.
+	Breaker BreakerState
+}
+
+// GetKeyStatus returns a snapshot of the status for the given key.
+// Returns false if the key does not exist.
+func (k *Keyed[K, V]) GetKeyStatus(key K) (KeyStatus[K], bool) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	v, existed := k.routines[key]
+	if !existed {
+		return KeyStatus[K]{Key: key}, false
+	}
+	return v.getStatus(), true
+}
+
+// GetAllStatuses returns a snapshot of the status of all keys.
+func (k *Keyed[K, V]) GetAllStatuses() []KeyStatus[K] {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	out := make([]KeyStatus[K], 0, len(k.routines))
+	for _, v := range k.routines {
+		out = append(out, v.getStatus())
+	}
+	return out
+}
+
+// getStatus returns the status of the routine.
+// expects r.k.mtx to be locked
+func (r *runningRoutine[K, V]) getStatus() KeyStatus[K] {
+	status := KeyStatus[K]{
+		Key:          r.key,
+		LastErr:      r.lastErr,
+		RestartCount: max(r.startCount-1, 0),
+		LastStarted:  r.lastStarted,
+	}
+	if r.breaker != nil {
+		status.Breaker = r.breaker.state
+	}
+	switch {
+	case r.deferRemove != nil:
+		status.State = KeyStatePendingRelease
+	case r.breaker != nil && r.breaker.state == BreakerOpen:
+		status.State = KeyStateParked
+		status.NextRetry = r.breaker.openUntil
+	case r.deferRetry != nil:
+		status.State = KeyStateRetrying
+		status.NextRetry = r.nextRetry
+	case r.queued:
+		status.State = KeyStateQueued
+	case r.ctx != nil && !r.exited && r.ctx.Err() == nil:
+		status.State = KeyStateRunning
+	case r.exited:
+		status.State = KeyStateExited
+	default:
+		status.State = KeyStateStopped
+	}
+	return status
+}
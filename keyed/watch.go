@@ -0,0 +1,129 @@
+package keyed
+
+import (
+	"context"
+	"time"
+
+	"github.com/aperturerobotics/util/ccontainer"
+)
+
+// WatchKeys reconciles the keys of a Keyed with a Watchable of desired keys.
+//
+// getKeys converts the watched value to the list of desired keys. SyncKeys is
+// called with the initial value and each time the value changes. If debounce
+// is > 0, waits until the value has not changed for debounce before syncing,
+// but at most maxDelay after the first change if maxDelay > 0. The keys are
+// not removed when WatchKeys returns.
+//
+// Returns context.Canceled when ctx is canceled.
+// errCh is an optional error channel to interrupt the operation.
+func WatchKeys[K comparable, V any, T comparable](
+	ctx context.Context,
+	k *Keyed[K, V],
+	w ccontainer.Watchable[T],
+	getKeys func(val T) []K,
+	debounce, maxDelay time.Duration,
+	errCh <-chan error,
+) error {
+	return watchKeys(ctx, w, getKeys, debounce, maxDelay, errCh, func(keys []K) {
+		_, _ = k.SyncKeys(keys, false)
+	})
+}
+
+// WatchKeyRefs reconciles references to keys of a KeyedRefCount with a
+// Watchable of desired keys.
+//
+// getKeys converts the watched value to the list of desired keys. A reference
+// is held to each desired key. References to keys which are no longer desired
+// are released. If debounce is > 0, waits until the value has not changed for
+// debounce before syncing, but at most maxDelay after the first change if
+// maxDelay > 0. All references are released when WatchKeyRefs returns.
+//
+// Returns context.Canceled when ctx is canceled.
+// errCh is an optional error channel to interrupt the operation.
+func WatchKeyRefs[K comparable, V any, T comparable](
+	ctx context.Context,
+	k *KeyedRefCount[K, V],
+	w ccontainer.Watchable[T],
+	getKeys func(val T) []K,
+	debounce, maxDelay time.Duration,
+	errCh <-chan error,
+) error {
+	refs := make(map[K]*KeyedRef[K, V])
+	defer func() {
+		for _, ref := range refs {
+			ref.Release()
+		}
+	}()
+
+	return watchKeys(ctx, w, getKeys, debounce, maxDelay, errCh, func(keys []K) {
+		desired := make(map[K]struct{}, len(keys))
+		for _, key := range keys {
+			desired[key] = struct{}{}
+			if _, ok := refs[key]; !ok {
+				refs[key], _, _ = k.AddKeyRef(key)
+			}
+		}
+		for key, ref := range refs {
+			if _, ok := desired[key]; !ok {
+				ref.Release()
+				delete(refs, key)
+			}
+		}
+	})
+}
+
+// watchKeys watches the Watchable and calls sync with the desired keys.
+func watchKeys[K comparable, T comparable](
+	ctx context.Context,
+	w ccontainer.Watchable[T],
+	getKeys func(val T) []K,
+	debounce, maxDelay time.Duration,
+	errCh <-chan error,
+	sync func(keys []K),
+) error {
+	curr := w.GetValue()
+	sync(getKeys(curr))
+	for {
+		next, err := w.WaitValueChange(ctx, curr, errCh)
+		if err != nil {
+			if ctx.Err() != nil {
+				return context.Canceled
+			}
+			return err
+		}
+		curr = next
+
+		// wait for the value to settle
+		var deadline time.Time
+		if maxDelay > 0 {
+			deadline = time.Now().Add(maxDelay)
+		}
+		for debounce > 0 {
+			wait := debounce
+			if !deadline.IsZero() {
+				wait = min(wait, time.Until(deadline))
+				if wait <= 0 {
+					// max delay passed
+					break
+				}
+			}
+			waitCtx, waitCtxCancel := context.WithTimeout(ctx, wait)
+			next, err = w.WaitValueChange(waitCtx, curr, errCh)
+			waitCtxCancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return context.Canceled
+				}
+				if waitCtx.Err() != nil {
+					// quiet period or max delay passed
+					break
+				}
+				return err
+			}
+			curr = next
+		}
+
+		sync(getKeys(curr))
+	}
+}
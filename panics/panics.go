@@ -0,0 +1,73 @@
+package panics
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicError is an error recovered from a panic.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack []byte
+}
+
+// NewPanicError constructs a PanicError with the current stack trace.
+func NewPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// Error returns the error string including the panic value.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("recovered panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// hook is the global panic hook.
+var hook atomic.Pointer[func(err *PanicError)]
+
+// SetHook sets the global hook called with each recovered panic.
+//
+// The hook is called on the goroutine which panicked.
+// If hook is nil, clears the hook.
+func SetHook(cb func(err *PanicError)) {
+	if cb == nil {
+		hook.Store(nil)
+	} else {
+		hook.Store(&cb)
+	}
+}
+
+// Report calls the global hook with the recovered panic, if set.
+func Report(err *PanicError) {
+	if cb := hook.Load(); cb != nil {
+		(*cb)(err)
+	}
+}
+
+// Recover recovers from a panic and stores a PanicError in errp.
+//
+// Must be called with defer directly: defer panics.Recover(&err)
+// Calls the global hook with the recovered panic.
+func Recover(errp *error) {
+	if v := recover(); v != nil {
+		err := NewPanicError(v)
+		Report(err)
+		*errp = err
+	}
+}
+
+// Call calls fn and returns a PanicError if fn panics.
+func Call(fn func() error) (err error) {
+	defer Recover(&err)
+	return fn()
+}
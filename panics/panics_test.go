@@ -0,0 +1,41 @@
+package panics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestCall tests recovering a panic as an error.
+func TestCall(t *testing.T) {
+	var reported *PanicError
+	SetHook(func(err *PanicError) {
+		reported = err
+	})
+	defer SetHook(nil)
+
+	if err := Call(func() error { return nil }); err != nil {
+		t.Fatal(err.Error())
+	}
+	if reported != nil {
+		t.Fatal("expected no panic to be reported")
+	}
+
+	errPanic := errors.New("test panic")
+	err := Call(func() error {
+		panic(errPanic)
+	})
+	var perr *PanicError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected panic error but got %v", err)
+	}
+	if !errors.Is(err, errPanic) {
+		t.Fatal("expected panic error to unwrap to the panic value")
+	}
+	if !strings.Contains(string(perr.Stack), "TestCall") {
+		t.Fatalf("expected stack trace to contain the caller: %s", perr.Stack)
+	}
+	if reported != perr {
+		t.Fatal("expected panic to be reported to the hook")
+	}
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+// DefaultBufferSize is the default number of buffered messages per subscriber.
+const DefaultBufferSize = 64
+
+// OverflowPolicy controls what happens when a subscriber buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest drops the oldest buffered message to make room.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest drops the message being published.
+	OverflowDropNewest
+	// OverflowBlock blocks the publisher until there is room.
+	OverflowBlock
+	// OverflowDisconnect disconnects the subscriber with ErrSlowConsumer.
+	OverflowDisconnect
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowBlock:
+		return "block"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return "unknown"
+	}
+}
+
+// SubscribeOption is an option for a Subscription.
+type SubscribeOption interface {
+	// applyToSubscription applies the option to the subscription settings.
+	applyToSubscription(s *subscribeOpts)
+}
+
+// subscribeOpts are the settings for a subscription.
+type subscribeOpts struct {
+	bufferSize int
+	overflow   OverflowPolicy
+}
+
+type subscribeOption struct {
+	cb func(s *subscribeOpts)
+}
+
+// newSubscribeOption constructs a new option.
+func newSubscribeOption(cb func(s *subscribeOpts)) *subscribeOption {
+	return &subscribeOption{cb: cb}
+}
+
+// applyToSubscription applies the option to the subscription settings.
+func (o *subscribeOption) applyToSubscription(s *subscribeOpts) {
+	if o.cb != nil {
+		o.cb(s)
+	}
+}
+
+// WithBufferSize sets the number of buffered messages for the subscriber.
+//
+// If n <= 0, DefaultBufferSize is used.
+func WithBufferSize(n int) SubscribeOption {
+	return newSubscribeOption(func(s *subscribeOpts) {
+		s.bufferSize = n
+	})
+}
+
+// WithOverflowPolicy sets the policy used when the subscriber buffer is full.
+//
+// Defaults to OverflowDropOldest.
+func WithOverflowPolicy(policy OverflowPolicy) SubscribeOption {
+	return newSubscribeOption(func(s *subscribeOpts) {
+		s.overflow = policy
+	})
+}
@@ -0,0 +1,231 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aperturerobotics/util/broadcast"
+	"github.com/aperturerobotics/util/filter"
+)
+
+// ErrClosed is returned when the bus or subscription is closed.
+var ErrClosed = errors.New("pubsub: closed")
+
+// errNilCtx is returned if a nil context is passed.
+var errNilCtx = errors.New("ctx must be set")
+
+// ErrSlowConsumer is returned by a subscription that was disconnected because
+// its buffer overflowed with OverflowDisconnect.
+var ErrSlowConsumer = errors.New("pubsub: slow consumer disconnected")
+
+// Message is a value published to a topic.
+type Message[T any] struct {
+	// Topic is the topic the value was published to.
+	Topic string
+	// Value is the published value.
+	Value T
+}
+
+// Bus is a topic-based publish/subscribe event bus.
+//
+// Each subscriber has a bounded buffer and an OverflowPolicy that decides what
+// happens when a publisher outpaces it. All state is guarded by a single
+// Broadcast: publishers wake subscribers, and subscribers wake blocked
+// publishers and Close when they make room.
+//
+// The zero-value of this struct is valid.
+type Bus[T any] struct {
+	// bcast guards below fields
+	bcast broadcast.Broadcast
+	// subs is the set of active subscriptions
+	subs map[*Subscription[T]]struct{}
+	// closing is set when Close is called
+	closing bool
+	// waiters is the number of blocked publishers and Close calls waiting for
+	// subscribers to make room
+	waiters int
+}
+
+// NewBus constructs a new Bus.
+func NewBus[T any]() *Bus[T] {
+	return &Bus[T]{}
+}
+
+// Subscribe subscribes to messages published to topic.
+//
+// Returns ErrClosed if the bus is closed.
+func (b *Bus[T]) Subscribe(topic string, opts ...SubscribeOption) (*Subscription[T], error) {
+	return b.subscribe(func(t string) bool { return t == topic }, opts)
+}
+
+// SubscribeFilter subscribes to messages with a topic matching the filter.
+//
+// A nil filter matches every topic. Returns an error if the filter is invalid,
+// or ErrClosed if the bus is closed.
+func (b *Bus[T]) SubscribeFilter(topicFilter *filter.StringFilter, opts ...SubscribeOption) (*Subscription[T], error) {
+	if err := topicFilter.Validate(); err != nil {
+		return nil, err
+	}
+	return b.subscribe(topicFilter.CheckMatch, opts)
+}
+
+// subscribe adds a subscription with the given topic matcher.
+func (b *Bus[T]) subscribe(match func(topic string) bool, opts []SubscribeOption) (*Subscription[T], error) {
+	conf := subscribeOpts{bufferSize: DefaultBufferSize}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyToSubscription(&conf)
+		}
+	}
+	if conf.bufferSize <= 0 {
+		conf.bufferSize = DefaultBufferSize
+	}
+
+	sub := &Subscription[T]{
+		bus:      b,
+		match:    match,
+		overflow: conf.overflow,
+		buf:      make([]Message[T], conf.bufferSize),
+	}
+
+	locked := b.bcast.Lock()
+	defer locked.Unlock()
+	if b.closing {
+		return nil, ErrClosed
+	}
+	if b.subs == nil {
+		b.subs = make(map[*Subscription[T]]struct{})
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish publishes a value to a topic.
+//
+// The value is delivered to every subscription matching the topic according to
+// its OverflowPolicy. If any matching subscriber uses OverflowBlock and its
+// buffer is full, Publish waits for it to make room. Returns context.Canceled
+// if ctx is canceled while waiting, in which case the value may have been
+// delivered to some of the subscribers. Returns ErrClosed if the bus is closed.
+func (b *Bus[T]) Publish(ctx context.Context, topic string, val T) error {
+	if ctx == nil {
+		return errNilCtx
+	}
+	msg := Message[T]{Topic: topic, Value: val}
+
+	locked := b.bcast.Lock()
+	if b.closing {
+		locked.Unlock()
+		return ErrClosed
+	}
+	var pending []*Subscription[T]
+	for sub := range b.subs {
+		if sub.match(topic) {
+			pending = append(pending, sub)
+		}
+	}
+
+	for {
+		var delivered bool
+		remaining := pending[:0]
+		for _, sub := range pending {
+			if sub.err != nil {
+				continue
+			}
+			switch {
+			case sub.pushLocked(msg):
+				delivered = true
+			case sub.overflow == OverflowBlock:
+				remaining = append(remaining, sub)
+			}
+		}
+		if delivered {
+			locked.Broadcast()
+		}
+		if len(remaining) == 0 {
+			locked.Unlock()
+			return nil
+		}
+		pending = remaining
+
+		b.waiters++
+		waitCh := locked.WaitCh()
+		locked.Unlock()
+		select {
+		case <-ctx.Done():
+			locked = b.bcast.Lock()
+			b.waiters--
+			locked.Unlock()
+			return context.Canceled
+		case <-waitCh:
+		}
+
+		locked = b.bcast.Lock()
+		b.waiters--
+		if b.closing {
+			locked.Unlock()
+			return ErrClosed
+		}
+	}
+}
+
+// Close closes the bus.
+//
+// New subscriptions and publishes return ErrClosed immediately, and publishers
+// blocked on a full subscriber return ErrClosed. Close then waits for the
+// subscribers to drain their buffered messages until ctx is canceled, after
+// which every remaining subscription is closed with ErrClosed. Returns
+// context.Canceled if ctx was canceled before all buffers were drained.
+func (b *Bus[T]) Close(ctx context.Context) error {
+	if ctx == nil {
+		return errNilCtx
+	}
+	var err error
+	var waiting bool
+	for {
+		locked := b.bcast.Lock()
+		if waiting {
+			b.waiters--
+			waiting = false
+		}
+		if !b.closing {
+			b.closing = true
+			locked.Broadcast()
+		}
+		drained := true
+		for sub := range b.subs {
+			if sub.n != 0 {
+				drained = false
+				break
+			}
+		}
+		if drained || err != nil {
+			for sub := range b.subs {
+				sub.closeLocked(ErrClosed)
+			}
+			locked.Broadcast()
+			locked.Unlock()
+			return err
+		}
+		b.waiters++
+		waiting = true
+		waitCh := locked.WaitCh()
+		locked.Unlock()
+
+		select {
+		case <-ctx.Done():
+			err = context.Canceled
+		case <-waitCh:
+		}
+	}
+}
+
+// wakeWaitersLocked wakes blocked publishers and Close after a subscriber made
+// room. Skips the broadcast if nobody is waiting to avoid waking every
+// subscriber on the bus.
+// expects bcast to be locked by caller
+func (b *Bus[T]) wakeWaitersLocked(locked *broadcast.Locked) {
+	if b.waiters != 0 {
+		locked.Broadcast()
+	}
+}
@@ -0,0 +1,244 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aperturerobotics/util/filter"
+)
+
+func TestBus_Topics(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+
+	fooSub, err := bus.Subscribe("foo")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	allSub, err := bus.SubscribeFilter(&filter.StringFilter{HasPrefix: "f"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := bus.SubscribeFilter(&filter.StringFilter{Re: "("}); err == nil {
+		t.Fatal("expected error for invalid filter")
+	}
+
+	for i, topic := range []string{"foo", "bar", "fizz"} {
+		if err := bus.Publish(ctx, topic, i); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	msg, err := fooSub.Next(ctx)
+	if err != nil || msg.Topic != "foo" || msg.Value != 0 {
+		t.Fatalf("unexpected message: %v %v", msg, err)
+	}
+	if _, ok := fooSub.TryNext(); ok {
+		t.Fatal("expected no more messages for foo")
+	}
+
+	var got []string
+	for range 2 {
+		msg, err := allSub.Next(ctx)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		got = append(got, msg.Topic)
+	}
+	if got[0] != "foo" || got[1] != "fizz" {
+		t.Fatalf("unexpected topics: %v", got)
+	}
+}
+
+func TestBus_OverflowDrop(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	oldest, _ := bus.Subscribe("t", WithBufferSize(2))
+	newest, _ := bus.Subscribe("t", WithBufferSize(2), WithOverflowPolicy(OverflowDropNewest))
+
+	for i := range 4 {
+		if err := bus.Publish(ctx, "t", i); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	check := func(sub *Subscription[int], expected ...int) {
+		t.Helper()
+		for _, exp := range expected {
+			msg, ok := sub.TryNext()
+			if !ok || msg.Value != exp {
+				t.Fatalf("expected %d, got %v (%v)", exp, msg.Value, ok)
+			}
+		}
+		if sub.Dropped() != 2 {
+			t.Fatalf("expected 2 dropped, got %d", sub.Dropped())
+		}
+	}
+	check(oldest, 2, 3)
+	check(newest, 0, 1)
+}
+
+func TestBus_OverflowBlock(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t", WithBufferSize(1), WithOverflowPolicy(OverflowBlock))
+
+	if err := bus.Publish(ctx, "t", 1); err != nil {
+		t.Fatal(err.Error())
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.Publish(ctx, "t", 2)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Publish returned while buffer was full: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	for _, exp := range []int{1, 2} {
+		msg, err := sub.Next(ctx)
+		if err != nil || msg.Value != exp {
+			t.Fatalf("expected %d, got %v %v", exp, msg.Value, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// blocked publishers observe cancellation
+	_ = bus.Publish(ctx, "t", 3)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Publish(cctx, "t", 4); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBus_OverflowDisconnect(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t", WithBufferSize(1), WithOverflowPolicy(OverflowDisconnect))
+
+	for i := range 3 {
+		if err := bus.Publish(ctx, "t", i); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil || msg.Value != 0 {
+		t.Fatalf("expected buffered message, got %v %v", msg.Value, err)
+	}
+	if _, err := sub.Next(ctx); !errors.Is(err, ErrSlowConsumer) {
+		t.Fatalf("expected ErrSlowConsumer, got %v", err)
+	}
+}
+
+func TestBus_Close(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t")
+	if err := bus.Publish(ctx, "t", 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.Close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Close returned before buffer was drained: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if err := bus.Publish(ctx, "t", 2); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+
+	msg, err := sub.Next(ctx)
+	if err != nil || msg.Value != 1 {
+		t.Fatalf("expected buffered message, got %v %v", msg.Value, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after drain")
+	}
+	if _, err := sub.Next(ctx); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if _, err := bus.Subscribe("t"); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBus_CloseCanceled(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t")
+	if err := bus.Publish(ctx, "t", 1); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(cctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := sub.Err(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestBus_PopWakesOnlyWaiters(t *testing.T) {
+	ctx := t.Context()
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t")
+	for i := range 2 {
+		if err := bus.Publish(ctx, "t", i); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	locked := bus.bcast.Lock()
+	waitCh := locked.WaitCh()
+	locked.Unlock()
+
+	// no publisher is blocked and Close is not waiting
+	if _, ok := sub.TryNext(); !ok {
+		t.Fatal("expected a message")
+	}
+	if _, err := sub.Next(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+	select {
+	case <-waitCh:
+		t.Fatal("pop woke the bus without any waiters")
+	default:
+	}
+}
+
+func TestBus_NilContext(t *testing.T) {
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t")
+	//nolint:staticcheck // testing nil context
+	if err := bus.Publish(nil, "t", 1); err == nil {
+		t.Fatal("expected error for nil ctx")
+	}
+	//nolint:staticcheck // testing nil context
+	if _, err := sub.Next(nil); err == nil {
+		t.Fatal("expected error for nil ctx")
+	}
+	//nolint:staticcheck // testing nil context
+	if err := bus.Close(nil); err == nil {
+		t.Fatal("expected error for nil ctx")
+	}
+}
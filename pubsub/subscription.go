@@ -0,0 +1,170 @@
+package pubsub
+
+import (
+	"context"
+)
+
+// Subscription receives messages published to a Bus.
+type Subscription[T any] struct {
+	// bus is the parent bus
+	bus *Bus[T]
+	// match checks if a topic matches
+	match func(topic string) bool
+	// overflow is the overflow policy
+	overflow OverflowPolicy
+
+	// below fields are guarded by bus.bcast
+	// buf is the ring buffer of messages
+	buf []Message[T]
+	// head is the index of the oldest message in buf
+	head int
+	// n is the number of messages in buf
+	n int
+	// dropped is the number of dropped messages
+	dropped uint64
+	// err is set when the subscription is closed
+	err error
+}
+
+// Next returns the next message, waiting for one if the buffer is empty.
+//
+// Buffered messages are returned before the subscription reports that it was
+// closed. Returns ErrClosed if the subscription or bus was closed,
+// ErrSlowConsumer if the subscriber was disconnected for falling behind, or
+// context.Canceled if ctx is canceled.
+func (s *Subscription[T]) Next(ctx context.Context) (Message[T], error) {
+	if ctx == nil {
+		var empty Message[T]
+		return empty, errNilCtx
+	}
+	for {
+		locked := s.bus.bcast.Lock()
+		msg, ok := s.popLocked()
+		if ok {
+			s.bus.wakeWaitersLocked(&locked)
+			locked.Unlock()
+			return msg, nil
+		}
+		if s.err == nil && s.bus.closing {
+			s.closeLocked(ErrClosed)
+			s.bus.wakeWaitersLocked(&locked)
+		}
+		if err := s.err; err != nil {
+			locked.Unlock()
+			return msg, err
+		}
+		waitCh := locked.WaitCh()
+		locked.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return msg, context.Canceled
+		case <-waitCh:
+		}
+	}
+}
+
+// TryNext returns the next buffered message without waiting.
+//
+// Returns false if the buffer is empty.
+func (s *Subscription[T]) TryNext() (Message[T], bool) {
+	locked := s.bus.bcast.Lock()
+	msg, ok := s.popLocked()
+	if ok {
+		s.bus.wakeWaitersLocked(&locked)
+	}
+	locked.Unlock()
+	return msg, ok
+}
+
+// Len returns the number of buffered messages.
+func (s *Subscription[T]) Len() int {
+	locked := s.bus.bcast.Lock()
+	n := s.n
+	locked.Unlock()
+	return n
+}
+
+// Dropped returns the number of messages dropped due to buffer overflow.
+func (s *Subscription[T]) Dropped() uint64 {
+	locked := s.bus.bcast.Lock()
+	dropped := s.dropped
+	locked.Unlock()
+	return dropped
+}
+
+// Err returns the error the subscription was closed with, if any.
+func (s *Subscription[T]) Err() error {
+	locked := s.bus.bcast.Lock()
+	err := s.err
+	locked.Unlock()
+	return err
+}
+
+// Release unsubscribes from the bus and discards any buffered messages.
+func (s *Subscription[T]) Release() {
+	locked := s.bus.bcast.Lock()
+	if s.err == nil {
+		s.closeLocked(ErrClosed)
+	}
+	clear(s.buf)
+	s.head, s.n = 0, 0
+	s.bus.wakeWaitersLocked(&locked)
+	locked.Unlock()
+}
+
+// pushLocked adds a message to the buffer applying the overflow policy.
+//
+// Returns true if the subscriber should be woken: the message was added or the
+// subscriber was disconnected. Returns false if the message was dropped or the
+// buffer is full with OverflowBlock.
+// expects bus.bcast to be locked by caller
+func (s *Subscription[T]) pushLocked(msg Message[T]) bool {
+	if s.n == len(s.buf) {
+		switch s.overflow {
+		case OverflowBlock:
+			return false
+		case OverflowDropNewest:
+			s.dropped++
+			return false
+		case OverflowDisconnect:
+			s.dropped++
+			s.closeLocked(ErrSlowConsumer)
+			// wake the subscriber to observe the error
+			return true
+		default:
+			s.dropped++
+			var empty Message[T]
+			s.buf[s.head] = empty
+			s.head = (s.head + 1) % len(s.buf)
+			s.n--
+		}
+	}
+	s.buf[(s.head+s.n)%len(s.buf)] = msg
+	s.n++
+	return true
+}
+
+// popLocked removes the oldest message from the buffer.
+// expects bus.bcast to be locked by caller
+func (s *Subscription[T]) popLocked() (Message[T], bool) {
+	var empty Message[T]
+	if s.n == 0 {
+		return empty, false
+	}
+	msg := s.buf[s.head]
+	s.buf[s.head] = empty
+	s.head = (s.head + 1) % len(s.buf)
+	s.n--
+	return msg, true
+}
+
+// closeLocked marks the subscription as closed and removes it from the bus.
+// Buffered messages are kept so they can still be returned by Next.
+// expects bus.bcast to be locked by caller
+func (s *Subscription[T]) closeLocked(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	delete(s.bus.subs, s)
+}
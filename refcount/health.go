@@ -0,0 +1,158 @@
+package refcount
+
+import (
+	"context"
+	"time"
+)
+
+// watchValueLocked starts the health check and rotation for the resolved value.
+// expects mtx is locked by caller
+func (r *RefCount[T]) watchValueLocked(val T) {
+	//nolint:gosec // valueCtxCancel is stored on RefCount and canceled when the value is cleared.
+	r.valueCtx, r.valueCtxCancel = context.WithCancel(r.ctx)
+	if r.opts == nil {
+		return
+	}
+	healthInterval, healthCheck := r.opts.HealthInterval, r.healthCheck
+	if healthInterval <= 0 {
+		healthCheck = nil
+	}
+	if healthCheck == nil && r.opts.MaxLifetime <= 0 {
+		return
+	}
+	go r.monitorValue(r.valueCtx, val, healthInterval, healthCheck, r.opts.MaxLifetime)
+}
+
+// stopWatchValueLocked stops the health check and rotation for the current value.
+// expects mtx is locked by caller
+func (r *RefCount[T]) stopWatchValueLocked() {
+	if r.valueCtxCancel != nil {
+		r.valueCtxCancel()
+		r.valueCtx, r.valueCtxCancel = nil, nil
+	}
+}
+
+// monitorValue runs the health check and rotation for a resolved value.
+// ctx is canceled when the value is cleared or replaced.
+func (r *RefCount[T]) monitorValue(
+	ctx context.Context,
+	val T,
+	healthInterval time.Duration,
+	healthCheck func(ctx context.Context, val T) error,
+	maxLifetime time.Duration,
+) {
+	var healthCh <-chan time.Time
+	if healthCheck != nil {
+		ticker := time.NewTicker(healthInterval)
+		defer ticker.Stop()
+		healthCh = ticker.C
+	}
+	var lifetimeCh <-chan time.Time
+	if maxLifetime > 0 {
+		timer := time.NewTimer(maxLifetime)
+		defer timer.Stop()
+		lifetimeCh = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-healthCh:
+			if err := healthCheck(ctx, val); err != nil && ctx.Err() == nil {
+				r.mtx.Lock()
+				if r.valueCtx == ctx {
+					r.traceLocked(TraceInvalidate, err, 0)
+					r.startResolveLocked(r.nextResolveDelayLocked())
+				}
+				r.mtx.Unlock()
+				return
+			}
+		case <-lifetimeCh:
+			r.rotateValue(ctx)
+			return
+		}
+	}
+}
+
+// rotateValue resolves a replacement for the value with valueCtx and swaps it in.
+func (r *RefCount[T]) rotateValue(valueCtx context.Context) {
+	r.mtx.Lock()
+	if r.valueCtx != valueCtx || r.ctx == nil {
+		r.mtx.Unlock()
+		return
+	}
+	//nolint:gosec // resolveCtxCancel is called if the rotation is abandoned.
+	resolveCtx, resolveCtxCancel := context.WithCancel(r.ctx)
+	// abandon the rotation if the old value is cleared
+	stopAbandon := context.AfterFunc(valueCtx, resolveCtxCancel)
+	r.mtx.Unlock()
+
+	// fields guarded by r.mtx
+	// nextValueCtx is the valueCtx of the replacement once swapped in
+	var nextValueCtx context.Context
+	// releasedEarly is set if released was called before the swap
+	var releasedEarly bool
+	released := func() {
+		resolveAfterRelease := func(lock bool) {
+			if lock {
+				r.mtx.Lock()
+			}
+			defer r.mtx.Unlock()
+			if nextValueCtx == nil {
+				releasedEarly = true
+			} else if r.valueCtx == nextValueCtx {
+				r.traceLocked(TraceInvalidate, nil, 0)
+				r.startResolveLocked(r.nextResolveDelayLocked())
+			}
+		}
+
+		if r.mtx.TryLock() {
+			resolveAfterRelease(false)
+		} else {
+			go resolveAfterRelease(true)
+		}
+	}
+
+	r.mtx.Lock()
+	r.resolveAttempts++
+	r.traceLocked(TraceResolveStart, nil, 0)
+	r.mtx.Unlock()
+
+	val, valRel, err := r.resolver(resolveCtx, released)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	stopAbandon()
+	if r.valueCtx == valueCtx {
+		r.recordResolveLocked(err, 0)
+	}
+	if r.valueCtx != valueCtx || err != nil || releasedEarly {
+		resolveCtxCancel()
+		if valRel != nil {
+			defer valRel()
+		}
+		if r.valueCtx == valueCtx {
+			// rotation failed: fall back to break-before-make
+			r.startResolveLocked(r.nextResolveDelayLocked())
+		}
+		return
+	}
+
+	// swap in the new value
+	// incrementing nonce marks the released callback of the old value as stale
+	oldRel := r.valueRel
+	r.nonce++
+	r.stopWatchValueLocked()
+	r.value, r.valueRel = val, valRel
+	if r.target != nil {
+		r.target.SetValue(val)
+	}
+	r.callRefCbsLocked(true, val, nil)
+	r.watchValueLocked(val)
+	nextValueCtx = r.valueCtx
+	r.traceLocked(TraceRelease, nil, 0)
+	if oldRel != nil {
+		oldRel()
+	}
+}
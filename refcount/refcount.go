@@ -11,6 +11,7 @@ import (
 	"github.com/aperturerobotics/util/broadcast"
 	"github.com/aperturerobotics/util/ccontainer"
 	"github.com/aperturerobotics/util/promise"
+	"github.com/aperturerobotics/util/result"
 )
 
 // RefCountResolver resolves a value within a RefCount container.
@@ -28,6 +29,22 @@ type Options struct {
 	ShouldRetry func(error) bool
 	// RetryDelay adjusts the fallback retry delay chosen by RetryBackoff.
 	RetryDelay func(error, time.Duration) time.Duration
+	// Trace is called on resolve start, success, failure, invalidation and
+	// release of the value.
+	// Called with the RefCount lock held: must not call RefCount methods.
+	Trace func(ev TraceEvent)
+	// HealthInterval is the interval between calls to the health check passed
+	// to NewRefCountWithHealthCheck. Health checks are disabled if <= 0.
+	HealthInterval time.Duration
+	// MaxLifetime is the max lifetime of a resolved value.
+	//
+	// Once a value reaches the max lifetime it is rotated make-before-break:
+	// the replacement is resolved in the background while the old value is
+	// still in use, the refs are notified with the new value through their
+	// callbacks, and only then is the old value released. If the replacement
+	// fails to resolve, the old value is invalidated and resolved again as
+	// usual. Disabled if <= 0.
+	MaxLifetime time.Duration
 }
 
 // RefCount is a refcount driven object container.
@@ -49,6 +66,8 @@ type RefCount[T comparable] struct {
 	resolver RefCountResolver[T]
 	// opts configures optional retry behavior.
 	opts *Options
+	// healthCheck checks the resolved value every opts.HealthInterval, if set.
+	healthCheck func(ctx context.Context, val T) error
 	// mtx guards below fields
 	mtx sync.Mutex
 	// refs is the list of references.
@@ -79,6 +98,19 @@ type RefCount[T comparable] struct {
 	valueErr error
 	// valueRel releases the current value.
 	valueRel func()
+	// valueCtx is canceled when the current value is cleared or replaced.
+	// nil if there is no resolved value.
+	valueCtx context.Context
+	// valueCtxCancel cancels valueCtx
+	valueCtxCancel context.CancelFunc
+	// resolveAttempts is the number of times the resolver was called.
+	resolveAttempts int
+	// consecutiveFailures is the number of failed resolves since the last success.
+	consecutiveFailures int
+	// lastResolved is the time the value was last resolved successfully.
+	lastResolved time.Time
+	// lastErr is the error from the last failed resolve.
+	lastErr error
 }
 
 // RefLike is an interface implemented by Ref.
@@ -128,15 +160,34 @@ func NewRefCountWithOptions[T comparable](
 	targetErr *ccontainer.CContainer[*error],
 	resolver RefCountResolver[T],
 	opts *Options,
+) *RefCount[T] {
+	return NewRefCountWithHealthCheck(ctx, keepUnref, target, targetErr, resolver, opts, nil)
+}
+
+// NewRefCountWithHealthCheck builds a new RefCount with a health check.
+//
+// healthCheck is called every opts.HealthInterval with the resolved value.
+// If it returns an error the value is invalidated and resolved again.
+// Called with a context canceled when the value is released.
+// Disabled if nil or if opts.HealthInterval <= 0.
+func NewRefCountWithHealthCheck[T comparable](
+	ctx context.Context,
+	keepUnref bool,
+	target *ccontainer.CContainer[T],
+	targetErr *ccontainer.CContainer[*error],
+	resolver RefCountResolver[T],
+	opts *Options,
+	healthCheck func(ctx context.Context, val T) error,
 ) *RefCount[T] {
 	return &RefCount[T]{
-		ctx:       ctx,
-		keepUnref: keepUnref,
-		target:    target,
-		targetErr: targetErr,
-		resolver:  resolver,
-		opts:      opts,
-		refs:      make(map[*Ref[T]]struct{}),
+		ctx:         ctx,
+		keepUnref:   keepUnref,
+		target:      target,
+		targetErr:   targetErr,
+		resolver:    resolver,
+		opts:        opts,
+		healthCheck: healthCheck,
+		refs:        make(map[*Ref[T]]struct{}),
 	}
 }
 
@@ -190,6 +241,7 @@ func (r *RefCount[T]) Invalidate() bool {
 	var changed bool
 	r.mtx.Lock()
 	if r.resolved {
+		r.traceLocked(TraceInvalidate, nil, 0)
 		r.startResolveLocked(r.nextResolveDelayLocked())
 		changed = true
 	} else if r.resolveCtxCancel != nil && !r.invalidatePending {
@@ -260,6 +312,28 @@ func (r *RefCount[T]) AddRefPromise() (promise.PromiseLike[T], *Ref[T]) {
 	return promCtr, ref
 }
 
+// AddRefWatchable adds a reference and returns a Watchable with the result.
+//
+// The Watchable contains nil while the value is unresolved and a Result with
+// the value or error once resolved. It is updated when the value is resolved
+// again, invalidated, or fails to resolve.
+func (r *RefCount[T]) AddRefWatchable() (ccontainer.Watchable[*result.Result[T]], *Ref[T]) {
+	ctr := ccontainer.NewCContainerWithEqual[*result.Result[T]](nil, func(a, b *result.Result[T]) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Compare(b)
+	})
+	ref := r.AddRef(func(resolved bool, val T, err error) {
+		if !resolved && err == nil {
+			ctr.SetValue(nil)
+		} else {
+			ctr.SetValue(result.NewResult(val, err))
+		}
+	})
+	return ctr, ref
+}
+
 // Wait adds a reference and waits for a value.
 // Returns the value, reference, and any error.
 // If err != nil, value and reference will be nil.
@@ -469,7 +543,11 @@ func (r *RefCount[T]) shutdownLocked(clearRetry bool) {
 // clearResolvedStateLocked clears the resolved state.
 // expects mtx is locked by caller
 func (r *RefCount[T]) clearResolvedStateLocked() {
+	r.stopWatchValueLocked()
 	if r.resolved {
+		if r.valueErr == nil {
+			r.traceLocked(TraceRelease, nil, 0)
+		}
 		r.resolved = false
 		if r.valueErr != nil {
 			r.valueErr = nil
@@ -563,6 +641,7 @@ func (r *RefCount[T]) resolve(
 			}
 			defer r.mtx.Unlock()
 			if r.nonce == nonce {
+				r.traceLocked(TraceInvalidate, nil, 0)
 				// calls shutdown internally
 				r.startResolveLocked(r.nextResolveDelayLocked())
 			}
@@ -575,6 +654,15 @@ func (r *RefCount[T]) resolve(
 		}
 	}
 
+	r.mtx.Lock()
+	if r.nonce != nonce {
+		r.mtx.Unlock()
+		return
+	}
+	r.resolveAttempts++
+	r.traceLocked(TraceResolveStart, nil, 0)
+	r.mtx.Unlock()
+
 	val, valRel, err := r.resolver(ctx, released)
 
 	r.mtx.Lock()
@@ -613,6 +701,7 @@ func (r *RefCount[T]) resolve(
 			if delay < 0 {
 				delay = 0
 			}
+			r.recordResolveLocked(err, delay)
 			if delay > 0 {
 				r.retryAt = time.Now().Add(delay)
 			} else {
@@ -626,6 +715,7 @@ func (r *RefCount[T]) resolve(
 		}
 	}
 	r.resetRetryLocked()
+	r.recordResolveLocked(err, 0)
 
 	// store the value and/or error
 	r.resolved = true
@@ -643,6 +733,7 @@ func (r *RefCount[T]) resolve(
 		if r.target != nil {
 			r.target.SetValue(val)
 		}
+		r.watchValueLocked(val)
 	}
 	r.callRefCbsLocked(true, val, err)
 }
@@ -3,12 +3,16 @@ package refcount
 import (
 	"context"
 	"errors"
+	"slices"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aperturerobotics/util/backoff"
 	"github.com/aperturerobotics/util/ccontainer"
+	"github.com/aperturerobotics/util/result"
 )
 
 // TestRefCount tests the RefCount mechanism.
@@ -523,3 +527,230 @@ func TestRefCount_ResolveAsRefCount(t *testing.T) {
 	}
 	ref.Release()
 }
+
+// TestRefCount_HealthCheck tests invalidating a value which fails the health check.
+func TestRefCount_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	var resolveCount atomic.Int32
+	var healthy atomic.Bool
+	healthy.Store(true)
+	rc := NewRefCountWithHealthCheck(ctx, false, nil, nil, func(ctx context.Context, released func()) (*int, func(), error) {
+		val := int(resolveCount.Add(1))
+		return &val, nil, nil
+	}, &Options{HealthInterval: time.Millisecond * 10}, func(ctx context.Context, val *int) error {
+		if !healthy.Load() {
+			return errors.New("unhealthy")
+		}
+		return nil
+	})
+
+	val, ref, err := rc.Wait(ctx)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer ref.Release()
+	if *val != 1 {
+		t.Fatalf("expected first value but got %d", *val)
+	}
+
+	<-time.After(time.Millisecond * 50)
+	if n := resolveCount.Load(); n != 1 {
+		t.Fatalf("expected healthy value to be kept: resolved %d times", n)
+	}
+
+	healthy.Store(false)
+	<-time.After(time.Millisecond * 50)
+	healthy.Store(true)
+	<-time.After(time.Millisecond * 50)
+	if n := resolveCount.Load(); n < 2 {
+		t.Fatalf("expected unhealthy value to be resolved again: resolved %d times", n)
+	}
+}
+
+// TestRefCount_MaxLifetime tests rotating a value make-before-break.
+func TestRefCount_MaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	var mtx sync.Mutex
+	var events []string
+	addEvent := func(ev string) {
+		mtx.Lock()
+		events = append(events, ev)
+		mtx.Unlock()
+	}
+	var resolveCount atomic.Int32
+	target := ccontainer.NewCContainer[*int](nil)
+	rc := NewRefCountWithOptions(ctx, false, target, nil, func(ctx context.Context, released func()) (*int, func(), error) {
+		val := int(resolveCount.Add(1))
+		addEvent("resolve " + strconv.Itoa(val))
+		return &val, func() {
+			addEvent("release " + strconv.Itoa(val))
+		}, nil
+	}, &Options{MaxLifetime: time.Millisecond * 50})
+
+	rotated := make(chan int, 10)
+	ref := rc.AddRef(func(resolved bool, val *int, err error) {
+		if !resolved {
+			addEvent("cleared")
+			return
+		}
+		addEvent("value " + strconv.Itoa(*val))
+		rotated <- *val
+	})
+	for _, expected := range []int{1, 2} {
+		select {
+		case val := <-rotated:
+			if val != expected {
+				t.Fatalf("expected value %d but got %d", expected, val)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected value %d", expected)
+		}
+	}
+	if val := target.GetValue(); val == nil || *val < 2 {
+		t.Fatal("expected target to contain the rotated value")
+	}
+	ref.Release()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	expected := []string{"resolve 1", "value 1", "resolve 2", "value 2", "release 1"}
+	if len(events) < len(expected) || !slices.Equal(events[:len(expected)], expected) {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
+
+// TestRefCount_AddRefWatchable tests watching the resolved value.
+func TestRefCount_AddRefWatchable(t *testing.T) {
+	ctx := context.Background()
+	errResolve := errors.New("test error")
+	var resolveCount atomic.Int32
+	rc := NewRefCount(ctx, false, nil, nil, func(ctx context.Context, released func()) (*int, func(), error) {
+		val := int(resolveCount.Add(1))
+		if val == 3 {
+			return nil, nil, errResolve
+		}
+		return &val, nil, nil
+	})
+
+	watchable, ref := rc.AddRefWatchable()
+	defer ref.Release()
+
+	res, err := watchable.WaitValue(ctx, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val, err := res.GetValue(); err != nil || *val != 1 {
+		t.Fatalf("unexpected first result: %v %v", val, err)
+	}
+
+	// follow re-resolutions with WaitValueChange
+	rc.Invalidate()
+	for {
+		res, err = watchable.WaitValueChange(ctx, res, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if res != nil {
+			break
+		}
+	}
+	if val, err := res.GetValue(); err != nil || *val != 2 {
+		t.Fatalf("unexpected second result: %v %v", val, err)
+	}
+
+	rc.Invalidate()
+	for {
+		res, err = watchable.WaitValueChange(ctx, res, nil)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if res != nil {
+			break
+		}
+	}
+	if _, err := res.GetValue(); err != errResolve {
+		t.Fatalf("expected resolve error but got %v", err)
+	}
+}
+
+// TestRefCount_StatsTrace tests the stats snapshot and the trace hook.
+func TestRefCount_StatsTrace(t *testing.T) {
+	ctx := context.Background()
+	retryErr := errors.New("retry me")
+	var calls atomic.Int32
+	var mtx sync.Mutex
+	var kinds []TraceEventKind
+	rc := NewRefCountWithOptions(
+		ctx,
+		false,
+		nil,
+		nil,
+		func(ctx context.Context, released func()) (*int, func(), error) {
+			n := int(calls.Add(1))
+			if n <= 2 {
+				return nil, nil, retryErr
+			}
+			return &n, nil, nil
+		},
+		&Options{
+			RetryBackoff: &backoff.Backoff{
+				BackoffKind: backoff.BackoffKind_BackoffKind_CONSTANT,
+				Constant:    &backoff.Constant{Interval: 100},
+			},
+			Trace: func(ev TraceEvent) {
+				mtx.Lock()
+				kinds = append(kinds, ev.Kind)
+				mtx.Unlock()
+			},
+		},
+	)
+
+	ref := rc.AddRef(nil)
+	<-time.After(time.Millisecond * 50)
+	stats := rc.Stats()
+	if stats.Refs != 1 || stats.ResolveAttempts != 1 || stats.ConsecutiveFailures != 1 || stats.Resolved {
+		t.Fatalf("unexpected stats after first failure: %+v", stats)
+	}
+	if stats.BackoffDelay <= 0 || !errors.Is(stats.LastErr, retryErr) {
+		t.Fatalf("expected backoff after first failure: %+v", stats)
+	}
+
+	// retryable errors are passed to the refs, wait for the value
+	watchable, valRef := rc.AddRefWatchable()
+	res, err := watchable.WaitValueWithValidator(ctx, func(res *result.Result[*int]) (bool, error) {
+		if res == nil {
+			return false, nil
+		}
+		val, _ := res.GetValue()
+		return val != nil, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if val, _ := res.GetValue(); *val != 3 {
+		t.Fatalf("expected value 3 but got %d", *val)
+	}
+	stats = rc.Stats()
+	if stats.Refs != 2 || stats.ResolveAttempts != 3 || stats.ConsecutiveFailures != 0 || !stats.Resolved {
+		t.Fatalf("unexpected stats after success: %+v", stats)
+	}
+	if stats.LastResolved.IsZero() || stats.BackoffDelay != 0 {
+		t.Fatalf("unexpected stats after success: %+v", stats)
+	}
+
+	rc.Invalidate()
+	valRef.Release()
+	ref.Release()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	expected := []TraceEventKind{
+		TraceResolveStart, TraceResolveFailure,
+		TraceResolveStart, TraceResolveFailure,
+		TraceResolveStart, TraceResolveSuccess,
+		TraceInvalidate, TraceRelease,
+	}
+	if len(kinds) < len(expected) || !slices.Equal(kinds[:len(expected)], expected) {
+		t.Fatalf("unexpected trace events: %v", kinds)
+	}
+}
@@ -0,0 +1,112 @@
+package refcount
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of the RefCount state.
+type Stats struct {
+	// Refs is the number of references.
+	Refs int
+	// Resolved indicates a value or error is currently resolved.
+	Resolved bool
+	// ResolveAttempts is the number of times the resolver was called.
+	ResolveAttempts int
+	// ConsecutiveFailures is the number of failed resolves since the last success.
+	ConsecutiveFailures int
+	// BackoffDelay is the remaining retry backoff delay, if any.
+	BackoffDelay time.Duration
+	// LastResolved is the time the value was last resolved successfully.
+	LastResolved time.Time
+	// LastErr is the error from the last failed resolve, if any.
+	LastErr error
+}
+
+// TraceEventKind is the kind of a TraceEvent.
+type TraceEventKind int
+
+const (
+	// TraceResolveStart is emitted when the resolver is called.
+	TraceResolveStart TraceEventKind = iota
+	// TraceResolveSuccess is emitted when the resolver returns a value.
+	TraceResolveSuccess
+	// TraceResolveFailure is emitted when the resolver returns an error.
+	// Delay is set if the resolve will be retried after a backoff.
+	TraceResolveFailure
+	// TraceInvalidate is emitted when the value is invalidated.
+	TraceInvalidate
+	// TraceRelease is emitted when the resolved value is released.
+	TraceRelease
+)
+
+// String returns the name of the trace event kind.
+func (k TraceEventKind) String() string {
+	switch k {
+	case TraceResolveStart:
+		return "resolve-start"
+	case TraceResolveSuccess:
+		return "resolve-success"
+	case TraceResolveFailure:
+		return "resolve-failure"
+	case TraceInvalidate:
+		return "invalidate"
+	case TraceRelease:
+		return "release"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceEvent is an event passed to Options.Trace.
+type TraceEvent struct {
+	// Kind is the kind of event.
+	Kind TraceEventKind
+	// Attempt is the number of the resolve attempt.
+	Attempt int
+	// Err is the resolve error, if any.
+	Err error
+	// Delay is the retry backoff delay, if any.
+	Delay time.Duration
+}
+
+// Stats returns a snapshot of the RefCount state.
+func (r *RefCount[T]) Stats() Stats {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return Stats{
+		Refs:                len(r.refs),
+		Resolved:            r.resolved,
+		ResolveAttempts:     r.resolveAttempts,
+		ConsecutiveFailures: r.consecutiveFailures,
+		BackoffDelay:        r.nextResolveDelayLocked(),
+		LastResolved:        r.lastResolved,
+		LastErr:             r.lastErr,
+	}
+}
+
+// traceLocked calls the trace hook, if set.
+// expects mtx is locked by caller
+func (r *RefCount[T]) traceLocked(kind TraceEventKind, err error, delay time.Duration) {
+	if r.opts != nil && r.opts.Trace != nil {
+		r.opts.Trace(TraceEvent{
+			Kind:    kind,
+			Attempt: r.resolveAttempts,
+			Err:     err,
+			Delay:   delay,
+		})
+	}
+}
+
+// recordResolveLocked records the result of a resolve attempt.
+// expects mtx is locked by caller
+func (r *RefCount[T]) recordResolveLocked(err error, delay time.Duration) {
+	if err != nil {
+		r.consecutiveFailures++
+		r.lastErr = err
+		r.traceLocked(TraceResolveFailure, err, delay)
+		return
+	}
+	r.consecutiveFailures = 0
+	r.lastResolved = time.Now()
+	r.traceLocked(TraceResolveSuccess, nil, 0)
+}
@@ -0,0 +1,220 @@
+package routine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the times a ScheduledRoutine runs.
+type Schedule interface {
+	// Next returns the next time after t.
+	// Returns the zero time if there are no more times.
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule runs at a fixed interval.
+type intervalSchedule time.Duration
+
+// Every returns a Schedule which runs at a fixed interval.
+// The interval is rounded up to at least one millisecond.
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule(max(interval, time.Millisecond))
+}
+
+// Next returns the next time after t.
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule is a parsed cron expression.
+type cronSchedule struct {
+	// minute, hour, dom, month, dow are bitsets of the matching values
+	minute, hour, dom, month, dow uint64
+	// domStar, dowStar indicate the day fields were unrestricted
+	domStar, dowStar bool
+}
+
+// cronDescriptors are the supported cron shorthands.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDowNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+	cronFields = [5]cronField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: cronMonthNames},
+		{name: "day of week", min: 0, max: 7, names: cronDowNames},
+	}
+)
+
+// ParseCron parses a standard five field cron expression.
+//
+// The fields are minute, hour, day of month, month and day of week. Each field
+// supports *, values, ranges (1-5), steps (*/15, 0-30/5) and lists (1,15).
+// Months and days of week may also be three letter names (jan, mon). Sunday is
+// 0 or 7. If both day of month and day of week are restricted, a time matches
+// if either matches. The shorthands @yearly, @monthly, @weekly, @daily and
+// @hourly are also supported. Times are matched in the location of the time
+// passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if desc, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = desc
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron: expected %d fields but got %d: %q", len(cronFields), len(fields), expr)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		var err error
+		bits[i], err = cronFields[i].parse(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// sunday may be 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = (bits[4] | 1) &^ (1 << 7)
+	}
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// MustParseCron parses a cron expression and panics if it is invalid.
+func MustParseCron(expr string) Schedule {
+	sched, err := ParseCron(expr)
+	if err != nil {
+		panic(err)
+	}
+	return sched
+}
+
+// parse parses the field into a bitset.
+func (f *cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron: invalid step in %s field: %q", f.name, part)
+			}
+		}
+
+		var lo, hi int
+		if rangePart == "*" {
+			lo, hi = f.min, f.max
+		} else {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			lo, err = f.parseValue(loPart)
+			if err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				hi, err = f.parseValue(hiPart)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("cron: invalid range in %s field: %q", f.name, part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses a single value of the field.
+func (f *cronField) parseValue(val string) (int, error) {
+	if v, ok := f.names[strings.ToLower(val)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("cron: invalid value in %s field: %q", f.name, val)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron: value out of range in %s field: %d", f.name, v)
+	}
+	return v, nil
+}
+
+// Next returns the next matching time after t.
+// Returns the zero time if there is no match within five years.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay checks if the day of month and day of week match.
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
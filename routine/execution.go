@@ -0,0 +1,82 @@
+package routine
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aperturerobotics/util/panics"
+)
+
+// Execution is a single run of a routine.
+//
+// Runs the routine with the heartbeat watchdog and panic recovery, and ensures
+// the exit of the run is handled exactly once: either when the routine stalls
+// or after it returns. Used by RoutineContainer, Supervisor and keyed.Keyed.
+type Execution struct {
+	// heartbeat is the heartbeat watchdog interval, if enabled.
+	heartbeat time.Duration
+	// recoverPanics indicates panics in the routine are recovered.
+	recoverPanics bool
+	// started is the time the execution was constructed.
+	started time.Time
+	// handled is set when the exit was handled.
+	handled atomic.Bool
+}
+
+// NewExecution constructs a new Execution which started now.
+//
+// If heartbeat > 0, the routine must call Heartbeat at least once per interval.
+// If recoverPanics is set, panics are returned as a *panics.PanicError.
+func NewExecution(heartbeat time.Duration, recoverPanics bool) *Execution {
+	return &Execution{
+		heartbeat:     heartbeat,
+		recoverPanics: recoverPanics,
+		started:       time.Now(),
+	}
+}
+
+// Started returns the time the execution started.
+func (e *Execution) Started() time.Time {
+	return e.started
+}
+
+// Run runs the routine and returns its error.
+//
+// If the routine stalls, its context is canceled and onStall is called from a
+// separate goroutine without waiting for the routine to return, unless the
+// exit was already handled. Returns ErrStalled if the routine stalled.
+func (e *Execution) Run(ctx context.Context, routine Routine, onStall func()) error {
+	rctx := ctx
+	var wd *Watchdog
+	if e.heartbeat > 0 {
+		rctx, wd = NewWatchdog(ctx, e.heartbeat, func() {
+			if e.Handle() {
+				onStall()
+			}
+		})
+	}
+
+	var err error
+	if e.recoverPanics {
+		err = panics.Call(func() error { return routine(rctx) })
+	} else {
+		err = routine(rctx)
+	}
+	if wd != nil && wd.Stop() {
+		err = ErrStalled
+	}
+	return err
+}
+
+// Handle marks the exit as handled.
+//
+// Returns false if the exit was already handled.
+func (e *Execution) Handle() bool {
+	return e.handled.CompareAndSwap(false, true)
+}
+
+// Handled returns if the exit was handled.
+func (e *Execution) Handled() bool {
+	return e.handled.Load()
+}
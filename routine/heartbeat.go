@@ -0,0 +1,102 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStalled is returned when a routine did not call Heartbeat within the
+// watchdog interval.
+var ErrStalled = errors.New("routine stalled: no heartbeat within interval")
+
+// heartbeatCtxKey is the context key for the watchdog.
+type heartbeatCtxKey struct{}
+
+// Heartbeat signals the watchdog attached to ctx that the routine is alive.
+//
+// Routines running with a heartbeat watchdog must call Heartbeat at least once
+// per watchdog interval. Does nothing if ctx has no watchdog.
+func Heartbeat(ctx context.Context) {
+	if w, ok := ctx.Value(heartbeatCtxKey{}).(*Watchdog); ok {
+		w.Heartbeat()
+	}
+}
+
+// Watchdog cancels a context if no heartbeat is received within an interval.
+type Watchdog struct {
+	// interval is the max time between heartbeats
+	interval time.Duration
+	// start is the time the watchdog was started
+	start time.Time
+	// ctxCancel cancels the context with a cause
+	ctxCancel context.CancelCauseFunc
+	// onStall is called when the routine stalls, if set
+	onStall func()
+	// timer checks for heartbeats
+	timer *time.Timer
+	// lastBeat is the time of the last heartbeat since start
+	lastBeat atomic.Int64
+	// stopped is set when the watchdog is stopped or stalled
+	stopped atomic.Bool
+	// stalled is set if the routine stalled
+	stalled atomic.Bool
+}
+
+// NewWatchdog starts a watchdog and returns a child context of ctx.
+//
+// If Heartbeat is not called with the context (or the Watchdog) within
+// interval, the context is canceled with ErrStalled as the cause and onStall
+// is called, if set. Stop must be called when the routine exits.
+func NewWatchdog(ctx context.Context, interval time.Duration, onStall func()) (context.Context, *Watchdog) {
+	w := &Watchdog{
+		interval: interval,
+		start:    time.Now(),
+		onStall:  onStall,
+	}
+	ctx, w.ctxCancel = context.WithCancelCause(ctx)
+	ctx = context.WithValue(ctx, heartbeatCtxKey{}, w)
+	w.timer = time.AfterFunc(interval, w.check)
+	return ctx, w
+}
+
+// Heartbeat signals that the routine is alive.
+func (w *Watchdog) Heartbeat() {
+	w.lastBeat.Store(int64(time.Since(w.start)))
+}
+
+// Stalled returns if the routine stalled.
+func (w *Watchdog) Stalled() bool {
+	return w.stalled.Load()
+}
+
+// Stop stops the watchdog and cancels the context.
+// Returns if the routine stalled.
+func (w *Watchdog) Stop() bool {
+	if w.stopped.CompareAndSwap(false, true) {
+		w.timer.Stop()
+		w.ctxCancel(context.Canceled)
+	}
+	return w.stalled.Load()
+}
+
+// check is called by the timer to check for a heartbeat.
+func (w *Watchdog) check() {
+	if w.stopped.Load() {
+		return
+	}
+	elapsed := time.Since(w.start) - time.Duration(w.lastBeat.Load())
+	if elapsed < w.interval {
+		w.timer.Reset(w.interval - elapsed)
+		return
+	}
+	if !w.stopped.CompareAndSwap(false, true) {
+		return
+	}
+	w.stalled.Store(true)
+	w.ctxCancel(ErrStalled)
+	if w.onStall != nil {
+		w.onStall()
+	}
+}
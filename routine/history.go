@@ -0,0 +1,82 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ExitRecord records a single run of a routine.
+type ExitRecord struct {
+	// Started is the time the routine was started.
+	Started time.Time
+	// Exited is the time the routine exited.
+	Exited time.Time
+	// Err is the error returned by the routine, if any.
+	Err error
+	// Canceled indicates the routine was canceled instead of failing.
+	Canceled bool
+	// Backoff is the retry backoff delay applied after the exit, if any.
+	Backoff time.Duration
+}
+
+// Failed returns if the routine exited with an error and was not canceled.
+func (r *ExitRecord) Failed() bool {
+	return r.Err != nil && !r.Canceled
+}
+
+// NewExitRecord constructs an ExitRecord for a run which exited now.
+//
+// canceled indicates the run context was canceled before the routine exited.
+// The record is also marked canceled if err is context.Canceled.
+func NewExitRecord(started time.Time, err error, canceled bool, backoff time.Duration) ExitRecord {
+	return ExitRecord{
+		Started:  started,
+		Exited:   time.Now(),
+		Err:      err,
+		Canceled: canceled || errors.Is(err, context.Canceled),
+		Backoff:  backoff,
+	}
+}
+
+// ExitHistory is a bounded ring buffer of ExitRecord.
+// Not concurrency safe: the caller must guard access.
+type ExitHistory struct {
+	// records is the ring buffer
+	records []ExitRecord
+	// next is the index of the next record to write
+	next int
+	// full indicates the ring buffer is full
+	full bool
+}
+
+// NewExitHistory constructs a new ExitHistory with the given size.
+// Returns nil if size <= 0.
+func NewExitHistory(size int) *ExitHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &ExitHistory{records: make([]ExitRecord, size)}
+}
+
+// Push adds a record, overwriting the oldest record if full.
+func (h *ExitHistory) Push(rec ExitRecord) {
+	h.records[h.next] = rec
+	h.next++
+	if h.next == len(h.records) {
+		h.next, h.full = 0, true
+	}
+}
+
+// Records returns a copy of the records from oldest to newest.
+func (h *ExitHistory) Records() []ExitRecord {
+	if h == nil {
+		return nil
+	}
+	if !h.full {
+		return append([]ExitRecord(nil), h.records[:h.next]...)
+	}
+	out := make([]ExitRecord, 0, len(h.records))
+	out = append(out, h.records[h.next:]...)
+	return append(out, h.records[:h.next]...)
+}
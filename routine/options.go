@@ -2,6 +2,7 @@ package routine
 
 import (
 	"context"
+	"time"
 
 	"github.com/aperturerobotics/util/backoff"
 	cbackoff "github.com/aperturerobotics/util/backoff/cbackoff"
@@ -14,6 +15,32 @@ type Option interface {
 	ApplyToRoutineContainer(k *RoutineContainer)
 }
 
+// SupervisorOption is an option for a Supervisor instance.
+type SupervisorOption interface {
+	// ApplyToSupervisor applies the option to the Supervisor.
+	ApplyToSupervisor(s *Supervisor)
+}
+
+// SharedOption is an option for both a RoutineContainer and a Supervisor.
+type SharedOption interface {
+	Option
+	SupervisorOption
+}
+
+// settings are the settings shared by RoutineContainer and Supervisor.
+type settings struct {
+	// exitedCbs is the set of exited callbacks.
+	exitedCbs []func(err error)
+	// retryBo is the retry backoff if retrying is enabled.
+	retryBo cbackoff.BackOff
+	// heartbeat is the heartbeat watchdog interval, if enabled.
+	heartbeat time.Duration
+	// recoverPanics indicates panics in the routine are recovered.
+	recoverPanics bool
+	// exitHistorySize is the number of runs to keep in the history, if enabled.
+	exitHistorySize int
+}
+
 type option struct {
 	cb func(k *RoutineContainer)
 }
@@ -30,15 +57,38 @@ func (o *option) ApplyToRoutineContainer(k *RoutineContainer) {
 	}
 }
 
+type sharedOption struct {
+	cb func(s *settings)
+}
+
+// newSharedOption constructs a new option which applies to the shared settings.
+func newSharedOption(cb func(s *settings)) *sharedOption {
+	return &sharedOption{cb: cb}
+}
+
+// ApplyToRoutineContainer applies the option to the RoutineContainer instance.
+func (o *sharedOption) ApplyToRoutineContainer(k *RoutineContainer) {
+	if o.cb != nil {
+		o.cb(&k.settings)
+	}
+}
+
+// ApplyToSupervisor applies the option to the Supervisor instance.
+func (o *sharedOption) ApplyToSupervisor(s *Supervisor) {
+	if o.cb != nil {
+		o.cb(&s.settings)
+	}
+}
+
 // WithExitCb adds a callback after a routine exits.
-func WithExitCb(cb func(err error)) Option {
-	return newOption(func(k *RoutineContainer) {
+func WithExitCb(cb func(err error)) SharedOption {
+	return newSharedOption(func(k *settings) {
 		k.exitedCbs = append(k.exitedCbs, cb)
 	})
 }
 
 // WithExitLogger adds a exited callback which logs information about the exit.
-func WithExitLogger(le *logrus.Entry) Option {
+func WithExitLogger(le *logrus.Entry) SharedOption {
 	return WithExitCb(NewLogExitedCallback(le))
 }
 
@@ -57,8 +107,8 @@ func NewLogExitedCallback(le *logrus.Entry) func(err error) {
 //
 // resets the backoff if the routine returned successfully.
 // disables the backoff if config is nil
-func WithRetry(boConf *backoff.Backoff) Option {
-	return newOption(func(k *RoutineContainer) {
+func WithRetry(boConf *backoff.Backoff) SharedOption {
+	return newSharedOption(func(k *settings) {
 		if boConf == nil {
 			k.retryBo = nil
 			return
@@ -72,8 +122,59 @@ func WithRetry(boConf *backoff.Backoff) Option {
 //
 // resets the backoff if the routine returned successfully.
 // disables the backoff if bo = nil
-func WithBackoff(bo cbackoff.BackOff) Option {
-	return newOption(func(k *RoutineContainer) {
+func WithBackoff(bo cbackoff.BackOff) SharedOption {
+	return newSharedOption(func(k *settings) {
 		k.retryBo = bo
 	})
 }
+
+// WithHeartbeat enables a heartbeat watchdog for the routine.
+//
+// The routine must call Heartbeat with its context at least once per interval.
+// If no heartbeat is received within interval, the routine context is canceled
+// and the routine is marked as exited with ErrStalled without waiting for it to
+// return. The routine is then restarted with the retry backoff, if set.
+// disables the watchdog if interval <= 0
+func WithHeartbeat(interval time.Duration) SharedOption {
+	return newSharedOption(func(k *settings) {
+		k.heartbeat = max(interval, 0)
+	})
+}
+
+// WithPanicRecovery recovers panics in the routine.
+//
+// A panic is returned from the routine as a *panics.PanicError with the panic
+// value and stack trace, and is passed to the exit callbacks and the retry
+// backoff like any other error. Calls the global hook set with panics.SetHook.
+func WithPanicRecovery() SharedOption {
+	return newSharedOption(func(k *settings) {
+		k.recoverPanics = true
+	})
+}
+
+// WithExitHistory keeps a history of the last n runs of the routine.
+//
+// Use GetExitHistory or Supervisor.GetChildExitHistory to read the history.
+// disables the history if n <= 0
+func WithExitHistory(n int) SharedOption {
+	return newSharedOption(func(k *settings) {
+		k.exitHistorySize = max(n, 0)
+	})
+}
+
+// WithStateDebounce coalesces state changes in a StateRoutineContainer.
+//
+// Does not apply to a Supervisor.
+//
+// After a state change the routine is restarted once no further changes are
+// made within quiet, but at most maxDelay after the first pending change. Only
+// the latest state is applied. If the state changes back to the state of the
+// running routine before the delay has passed, the restart is canceled.
+// disables debounce if quiet <= 0
+// if maxDelay <= 0, the restart is delayed until the state is quiet
+func WithStateDebounce(quiet, maxDelay time.Duration) Option {
+	return newOption(func(k *RoutineContainer) {
+		k.debounceQuiet = max(quiet, 0)
+		k.debounceMaxDelay = max(maxDelay, 0)
+	})
+}
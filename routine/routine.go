@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/aperturerobotics/util/backoff"
-	cbackoff "github.com/aperturerobotics/util/backoff/cbackoff"
 	"github.com/aperturerobotics/util/broadcast"
 	"github.com/sirupsen/logrus"
 )
@@ -17,16 +16,25 @@ type Routine func(ctx context.Context) error
 
 // RoutineContainer contains a Routine.
 type RoutineContainer struct {
-	// exitedCbs is the set of exited callbacks.
-	exitedCbs []func(err error)
+	// settings are the settings shared with Supervisor.
+	settings
 	// bcast guards below fields
 	bcast broadcast.Broadcast
 	// ctx is the current root context
 	ctx context.Context
 	// routine is the current running routine, if any
 	routine *runningRoutine
-	// retryBo is the retry backoff if retrying is enabled.
-	retryBo cbackoff.BackOff
+	// exitHistory is the history of runs, if enabled.
+	// guarded by bcast
+	exitHistory *ExitHistory
+	// debounceQuiet is the state debounce quiet period used by StateRoutineContainer.
+	debounceQuiet time.Duration
+	// debounceMaxDelay is the state debounce max delay used by StateRoutineContainer.
+	debounceMaxDelay time.Duration
+	// running is the number of running routine goroutines.
+	running int
+	// collectors is the list of active exit collectors.
+	collectors []*exitCollector
 }
 
 // NewRoutineContainer constructs a new RoutineContainer.
@@ -38,6 +46,7 @@ func NewRoutineContainer(opts ...Option) *RoutineContainer {
 			opt.ApplyToRoutineContainer(c)
 		}
 	}
+	c.exitHistory = NewExitHistory(c.exitHistorySize)
 	return c
 }
 
@@ -133,6 +142,16 @@ func (k *RoutineContainer) ClearContext() bool {
 	return k.SetContext(nil, false)
 }
 
+// GetExitHistory returns the recent runs of the routine from oldest to newest.
+// Returns nil if WithExitHistory was not set.
+func (k *RoutineContainer) GetExitHistory() []ExitRecord {
+	var records []ExitRecord
+	k.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		records = k.exitHistory.Records()
+	})
+	return records
+}
+
 // getRunningLocked returns if the routine is running.
 func (k *RoutineContainer) getRunningLocked() bool {
 	return k.ctx != nil && k.ctx.Err() == nil && k.routine != nil && !k.routine.exited
@@ -278,6 +297,7 @@ func (r *runningRoutine) start(ctx context.Context, waitCh <-chan struct{}, forc
 	r.success, r.exited = false, false
 	r.exitedCh = exitedCh
 	r.ctx, r.ctxCancel = context.WithCancel(ctx)
+	r.r.running++
 	go r.execute(r.ctx, exitedCh, waitCh)
 }
 
@@ -298,47 +318,74 @@ func (r *runningRoutine) execute(
 		err = context.Canceled
 	}
 
+	exec := NewExecution(r.r.heartbeat, r.r.recoverPanics)
 	if err == nil {
-		err = r.routine(ctx)
+		err = exec.Run(ctx, r.routine, func() {
+			// mark the routine as exited without waiting for it to return
+			r.r.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+				r.exitedLocked(ctx, exec.Started(), ErrStalled, broadcast)
+			})
+		})
 	}
 	close(exitedCh)
 
 	r.r.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
-		if r.ctx == ctx {
-			r.err = err
-			r.success = err == nil
-			r.exited = true
-			r.exitedCh = nil
-			if r.r.retryBo != nil {
-				if r.deferRetry != nil {
-					r.deferRetry.Stop()
-					r.deferRetry = nil
-				}
-				if r.success {
-					r.r.retryBo.Reset()
-				} else if r.r.routine == r {
-					dur := r.r.retryBo.NextBackOff()
-					if dur != backoff.Stop {
-						r.deferRetry = time.AfterFunc(dur, func() {
-							r.r.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
-								if r.r.ctx != nil && r.r.routine == r && r.exited {
-									r.start(r.r.ctx, r.exitedCh, true)
-								}
-								broadcast()
-							})
-						})
-					}
-				}
-			}
-			for i := len(r.r.exitedCbs) - 1; i >= 0; i-- {
-				// run after unlocking bcast
-				defer r.r.exitedCbs[i](err)
-			}
+		r.r.running--
+		r.r.collectExitLocked(err)
+		if r.r.running == 0 {
 			broadcast()
 		}
+		if exec.Handle() {
+			r.exitedLocked(ctx, exec.Started(), err, broadcast)
+		}
 	})
 }
 
+// exitedLocked marks the routine running with ctx as exited with err.
+// expects r.r.bcast to be locked by caller
+func (r *runningRoutine) exitedLocked(ctx context.Context, started time.Time, err error, broadcast func()) {
+	var delay time.Duration
+	if r.r.exitHistory != nil {
+		defer func() {
+			r.r.exitHistory.Push(NewExitRecord(started, err, ctx.Err() != nil, delay))
+		}()
+	}
+	if r.ctx != ctx {
+		return
+	}
+	r.err = err
+	r.success = err == nil
+	r.exited = true
+	r.exitedCh = nil
+	if r.r.retryBo != nil {
+		if r.deferRetry != nil {
+			r.deferRetry.Stop()
+			r.deferRetry = nil
+		}
+		if r.success {
+			r.r.retryBo.Reset()
+		} else if r.r.routine == r {
+			dur := r.r.retryBo.NextBackOff()
+			if dur != backoff.Stop {
+				delay = dur
+				r.deferRetry = time.AfterFunc(dur, func() {
+					r.r.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+						if r.r.ctx != nil && r.r.routine == r && r.exited {
+							r.start(r.r.ctx, r.exitedCh, true)
+						}
+						broadcast()
+					})
+				})
+			}
+		}
+	}
+	for i := len(r.r.exitedCbs) - 1; i >= 0; i-- {
+		// run after unlocking bcast
+		defer r.r.exitedCbs[i](err)
+	}
+	broadcast()
+}
+
 // stop is called when the routine is removed / canceled.
 // expects r.r.mtx to be locked
 func (r *runningRoutine) stop() {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/aperturerobotics/util/backoff"
+	"github.com/aperturerobotics/util/panics"
 	"github.com/sirupsen/logrus"
 )
 
@@ -263,3 +264,156 @@ func TestRoutineContainer_WithBackoff(t *testing.T) {
 	// expect backoffs to occur
 	<-vals
 }
+
+// TestRoutineContainer_Shutdown tests waiting for the routine to exit on shutdown.
+func TestRoutineContainer_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	flushErr := errors.New("flush failed")
+	var exited atomic.Bool
+	startedCh := make(chan struct{}, 1)
+	k := NewRoutineContainer()
+	_, _ = k.SetRoutine(func(ctx context.Context) error {
+		startedCh <- struct{}{}
+		<-ctx.Done()
+		// simulate flushing state after cancel
+		<-time.After(time.Millisecond * 20)
+		exited.Store(true)
+		return flushErr
+	})
+	k.SetContext(ctx, false)
+	<-startedCh
+
+	err := k.Shutdown(ctx)
+	if !exited.Load() {
+		t.Fatal("expected routine to have exited")
+	}
+	if !errors.Is(err, flushErr) {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+	if err := k.WaitAllExited(ctx); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+// TestRoutineContainer_Heartbeat tests restarting a routine which stops sending heartbeats.
+func TestRoutineContainer_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+	stalledCh := make(chan error, 1)
+	bo := (&backoff.Backoff{
+		BackoffKind: backoff.BackoffKind_BackoffKind_EXPONENTIAL,
+		Exponential: &backoff.Exponential{
+			InitialInterval: 10,
+			MaxInterval:     50,
+		},
+	}).Construct()
+	k := NewRoutineContainer(
+		WithHeartbeat(time.Millisecond*50),
+		WithBackoff(bo),
+		WithExitCb(func(err error) {
+			stalledCh <- err
+		}),
+	)
+
+	var runs atomic.Int32
+	hang := make(chan struct{})
+	defer close(hang)
+	doneCh := make(chan struct{})
+	_, _ = k.SetRoutine(func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			// send a few heartbeats then hang ignoring ctx
+			for range 3 {
+				Heartbeat(ctx)
+				<-time.After(time.Millisecond * 20)
+			}
+			<-hang
+			return nil
+		}
+		close(doneCh)
+		return nil
+	})
+	k.SetContext(ctx, false)
+
+	select {
+	case err := <-stalledCh:
+		if err != ErrStalled {
+			t.Fatalf("expected stalled error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected routine to stall")
+	}
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		t.Fatal("expected routine to be restarted")
+	}
+}
+
+// TestRoutineContainer_PanicRecovery tests recovering a panic in the routine.
+func TestRoutineContainer_PanicRecovery(t *testing.T) {
+	ctx := context.Background()
+	var reported atomic.Pointer[panics.PanicError]
+	panics.SetHook(func(err *panics.PanicError) {
+		reported.Store(err)
+	})
+	defer panics.SetHook(nil)
+
+	k := NewRoutineContainer(WithPanicRecovery())
+	_, _ = k.SetRoutine(func(ctx context.Context) error {
+		panic("test panic")
+	})
+	k.SetContext(ctx, false)
+
+	err := k.WaitExited(ctx, false, nil)
+	var perr *panics.PanicError
+	if !errors.As(err, &perr) || perr.Value != "test panic" {
+		t.Fatalf("expected panic error but got %v", err)
+	}
+	if reported.Load() != perr {
+		t.Fatal("expected panic to be reported to the hook")
+	}
+}
+
+// TestRoutineContainer_ExitHistory tests the bounded exit history.
+func TestRoutineContainer_ExitHistory(t *testing.T) {
+	ctx := context.Background()
+	bo := (&backoff.Backoff{
+		BackoffKind: backoff.BackoffKind_BackoffKind_EXPONENTIAL,
+		Exponential: &backoff.Exponential{
+			InitialInterval: 10,
+			MaxInterval:     50,
+		},
+	}).Construct()
+	k := NewRoutineContainer(WithExitHistory(3), WithBackoff(bo))
+
+	var runs atomic.Int32
+	_, _ = k.SetRoutine(func(ctx context.Context) error {
+		if runs.Add(1) <= 4 {
+			return errors.New("test error")
+		}
+		return nil
+	})
+	k.SetContext(ctx, false)
+	for runs.Load() < 5 {
+		<-time.After(time.Millisecond * 10)
+	}
+	if err := k.WaitExited(ctx, false, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	records := k.GetExitHistory()
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records but got %d", len(records))
+	}
+	for i, rec := range records[:2] {
+		if !rec.Failed() || rec.Backoff <= 0 {
+			t.Fatalf("expected record %d to be failed with backoff: %v", i, rec)
+		}
+	}
+	last := records[2]
+	if last.Failed() || last.Err != nil || last.Backoff != 0 {
+		t.Fatalf("expected last record to be successful: %v", last)
+	}
+	if last.Exited.Before(last.Started) || last.Started.Before(records[1].Exited) {
+		t.Fatal("expected records to be ordered")
+	}
+}
@@ -0,0 +1,281 @@
+package routine
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// OverlapPolicy controls what happens when a scheduled run is due while the
+// previous run is still running.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run if the previous run is still running.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue runs once more after the previous run exits.
+	// Multiple runs due while running are coalesced into one.
+	OverlapQueue
+	// OverlapCancel cancels the previous run and runs after it exits.
+	OverlapCancel
+)
+
+// String returns the name of the overlap policy.
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapSkip:
+		return "skip"
+	case OverlapQueue:
+		return "queue"
+	case OverlapCancel:
+		return "cancel"
+	default:
+		return "unknown"
+	}
+}
+
+// Clock is a source of time for a ScheduledRoutine.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer which fires after d.
+	NewTimer(d time.Duration) ClockTimer
+}
+
+// ClockTimer is a timer returned by a Clock.
+type ClockTimer interface {
+	// C returns the channel which receives the time when the timer fires.
+	C() <-chan time.Time
+	// Stop stops the timer.
+	Stop() bool
+}
+
+// realClock is the Clock using the time package.
+type realClock struct{}
+
+// RealClock returns the Clock using the time package.
+func RealClock() Clock {
+	return realClock{}
+}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a timer which fires after d.
+func (realClock) NewTimer(d time.Duration) ClockTimer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// realTimer wraps time.Timer.
+type realTimer struct {
+	*time.Timer
+}
+
+// C returns the channel which receives the time when the timer fires.
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// ScheduleOption is an option for a ScheduledRoutine.
+type ScheduleOption interface {
+	// ApplyToScheduledRoutine applies the option to the ScheduledRoutine.
+	ApplyToScheduledRoutine(s *ScheduledRoutine)
+}
+
+type scheduleOption struct {
+	cb func(s *ScheduledRoutine)
+}
+
+// newScheduleOption constructs a new schedule option.
+func newScheduleOption(cb func(s *ScheduledRoutine)) *scheduleOption {
+	return &scheduleOption{cb: cb}
+}
+
+// ApplyToScheduledRoutine applies the option to the ScheduledRoutine.
+func (o *scheduleOption) ApplyToScheduledRoutine(s *ScheduledRoutine) {
+	if o.cb != nil {
+		o.cb(s)
+	}
+}
+
+// WithOverlapPolicy sets the overlap policy.
+// Defaults to OverlapSkip.
+func WithOverlapPolicy(policy OverlapPolicy) ScheduleOption {
+	return newScheduleOption(func(s *ScheduledRoutine) {
+		s.overlap = policy
+	})
+}
+
+// WithJitter delays each run by a random duration in [0, jitter).
+func WithJitter(jitter time.Duration) ScheduleOption {
+	return newScheduleOption(func(s *ScheduledRoutine) {
+		s.jitter = max(jitter, 0)
+	})
+}
+
+// WithCatchUp runs once immediately if any runs were missed.
+//
+// Runs are missed if the scheduler falls behind by more than a full tick, for
+// example if the process was suspended. Without catch up, missed runs are
+// dropped and the scheduler waits for the next time in the future.
+func WithCatchUp() ScheduleOption {
+	return newScheduleOption(func(s *ScheduledRoutine) {
+		s.catchUp = true
+	})
+}
+
+// WithClock sets the clock used for scheduling.
+// Defaults to RealClock.
+func WithClock(clock Clock) ScheduleOption {
+	return newScheduleOption(func(s *ScheduledRoutine) {
+		if clock != nil {
+			s.clock = clock
+		}
+	})
+}
+
+// WithRunExitCb adds a callback called after each run exits.
+func WithRunExitCb(cb func(err error)) ScheduleOption {
+	return newScheduleOption(func(s *ScheduledRoutine) {
+		s.exitedCbs = append(s.exitedCbs, cb)
+	})
+}
+
+// ScheduledRoutine runs a Routine on a Schedule.
+//
+// Runs never overlap: see OverlapPolicy. Errors returned by the routine are
+// passed to the WithRunExitCb callbacks and do not stop the schedule.
+//
+// ScheduledRoutine.Execute is a Routine: use a RoutineContainer to start and
+// stop it with a context.
+type ScheduledRoutine struct {
+	// schedule is the schedule
+	schedule Schedule
+	// routine is the routine to run
+	routine Routine
+	// overlap is the overlap policy
+	overlap OverlapPolicy
+	// jitter is the max random delay added to each run
+	jitter time.Duration
+	// catchUp indicates missed runs are caught up
+	catchUp bool
+	// clock is the clock
+	clock Clock
+	// exitedCbs is the set of run exited callbacks
+	exitedCbs []func(err error)
+}
+
+// NewScheduledRoutine constructs a new ScheduledRoutine.
+func NewScheduledRoutine(schedule Schedule, routine Routine, opts ...ScheduleOption) *ScheduledRoutine {
+	s := &ScheduledRoutine{
+		schedule: schedule,
+		routine:  routine,
+		clock:    RealClock(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyToScheduledRoutine(s)
+		}
+	}
+	return s
+}
+
+// Execute runs the routine on the schedule until ctx is canceled.
+//
+// Returns nil if the schedule has no more times and the last run exited.
+// Returns context.Canceled if ctx is canceled.
+// The running routine, if any, has exited when Execute returns.
+func (s *ScheduledRoutine) Execute(ctx context.Context) error {
+	// runDoneCh receives the result of the running routine
+	runDoneCh := make(chan error, 1)
+	// runCancel cancels the running routine, nil if not running
+	var runCancel context.CancelFunc
+	// pending indicates a run is pending after the current run exits
+	var pending bool
+
+	startRun := func() {
+		runCtx, cancel := context.WithCancel(ctx)
+		runCancel = cancel
+		go func() {
+			err := s.routine(runCtx)
+			cancel()
+			runDoneCh <- err
+		}()
+	}
+	defer func() {
+		if runCancel != nil {
+			runCancel()
+			<-runDoneCh
+		}
+	}()
+
+	// tick is the next scheduled time and delay is the jitter for tick
+	var tick time.Time
+	var delay time.Duration
+	setTick := func(t time.Time) {
+		tick, delay = t, 0
+		if s.jitter > 0 && !t.IsZero() {
+			delay = rand.N(s.jitter)
+		}
+	}
+	setTick(s.schedule.Next(s.clock.Now()))
+
+	for {
+		if tick.IsZero() && runCancel == nil && !pending {
+			return nil
+		}
+
+		var timer ClockTimer
+		var timerCh <-chan time.Time
+		if !tick.IsZero() {
+			timer = s.clock.NewTimer(tick.Add(delay).Sub(s.clock.Now()))
+			timerCh = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return context.Canceled
+		case err := <-runDoneCh:
+			if timer != nil {
+				timer.Stop()
+			}
+			runCancel = nil
+			for _, cb := range s.exitedCbs {
+				cb(err)
+			}
+			if pending {
+				pending = false
+				startRun()
+			}
+			continue
+		case <-timerCh:
+		}
+
+		// check if we fell behind by more than a full tick
+		now := s.clock.Now().Add(-delay)
+		next := s.schedule.Next(tick)
+		missed := !next.IsZero() && !next.After(now)
+		for !next.IsZero() && !next.After(now) {
+			next = s.schedule.Next(next)
+		}
+		setTick(next)
+		if missed && !s.catchUp {
+			continue
+		}
+
+		switch {
+		case runCancel == nil:
+			startRun()
+		case s.overlap == OverlapQueue:
+			pending = true
+		case s.overlap == OverlapCancel:
+			runCancel()
+			pending = true
+		}
+	}
+}
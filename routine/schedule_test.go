@@ -0,0 +1,264 @@
+package routine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a manually advanced Clock.
+type testClock struct {
+	mtx    sync.Mutex
+	now    time.Time
+	timers []*testTimer
+}
+
+// testTimer is a timer of a testClock.
+type testTimer struct {
+	clock    *testClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newTestClock(now time.Time) *testClock {
+	return &testClock{now: now}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) ClockTimer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	t := &testTimer{clock: c, deadline: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t
+}
+
+// Advance advances the clock and fires the expired timers.
+func (c *testClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.deadline.After(c.now) {
+			t.ch <- c.now
+		} else {
+			timers = append(timers, t)
+		}
+	}
+	c.timers = timers
+}
+
+// waitTimer waits for a timer to be pending.
+func (c *testClock) waitTimer(t *testing.T) {
+	t.Helper()
+	for range 200 {
+		c.mtx.Lock()
+		n := len(c.timers)
+		c.mtx.Unlock()
+		if n != 0 {
+			return
+		}
+		<-time.After(time.Millisecond * 5)
+	}
+	t.Fatal("expected a pending timer")
+}
+
+func (t *testTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *testTimer) Stop() bool {
+	c := t.clock
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for i, ct := range c.timers {
+		if ct == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleTestJob is a job which blocks until released or canceled.
+type scheduleTestJob struct {
+	starts  chan context.Context
+	release chan struct{}
+}
+
+func newScheduleTestJob() *scheduleTestJob {
+	return &scheduleTestJob{
+		starts:  make(chan context.Context, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (j *scheduleTestJob) execute(ctx context.Context) error {
+	j.starts <- ctx
+	select {
+	case <-ctx.Done():
+		return context.Canceled
+	case <-j.release:
+		return nil
+	}
+}
+
+// expectStart waits for the job to start.
+func (j *scheduleTestJob) expectStart(t *testing.T) context.Context {
+	t.Helper()
+	select {
+	case ctx := <-j.starts:
+		return ctx
+	case <-time.After(time.Second):
+		t.Fatal("expected job to start")
+		return nil
+	}
+}
+
+// expectNoStart checks the job did not start.
+func (j *scheduleTestJob) expectNoStart(t *testing.T) {
+	t.Helper()
+	select {
+	case <-j.starts:
+		t.Fatal("unexpected job start")
+	default:
+	}
+}
+
+// TestScheduledRoutine_Overlap tests the overlap policies.
+func TestScheduledRoutine_Overlap(t *testing.T) {
+	for _, policy := range []OverlapPolicy{OverlapSkip, OverlapQueue, OverlapCancel} {
+		t.Run(policy.String(), func(t *testing.T) {
+			ctx, ctxCancel := context.WithCancel(context.Background())
+			defer ctxCancel()
+
+			clk := newTestClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			job := newScheduleTestJob()
+			exited := make(chan struct{}, 10)
+			sr := NewScheduledRoutine(
+				Every(time.Minute),
+				job.execute,
+				WithClock(clk),
+				WithOverlapPolicy(policy),
+				WithRunExitCb(func(err error) { exited <- struct{}{} }),
+			)
+			errCh := make(chan error, 1)
+			go func() { errCh <- sr.Execute(ctx) }()
+
+			clk.waitTimer(t)
+			clk.Advance(time.Minute)
+			firstCtx := job.expectStart(t)
+
+			// tick while running
+			clk.waitTimer(t)
+			clk.Advance(time.Minute)
+			clk.waitTimer(t)
+
+			switch policy {
+			case OverlapSkip:
+				job.expectNoStart(t)
+				job.release <- struct{}{}
+				<-exited
+				clk.waitTimer(t)
+				job.expectNoStart(t)
+				clk.Advance(time.Minute)
+				job.expectStart(t)
+			case OverlapQueue:
+				job.expectNoStart(t)
+				job.release <- struct{}{}
+				job.expectStart(t)
+			case OverlapCancel:
+				job.expectStart(t)
+				if firstCtx.Err() == nil {
+					t.Fatal("expected first run to be canceled")
+				}
+			}
+
+			ctxCancel()
+			if err := <-errCh; err != context.Canceled {
+				t.Fatalf("expected context canceled but got %v", err)
+			}
+		})
+	}
+}
+
+// TestScheduledRoutine_CatchUp tests catching up after missed runs.
+func TestScheduledRoutine_CatchUp(t *testing.T) {
+	for _, catchUp := range []bool{false, true} {
+		ctx, ctxCancel := context.WithCancel(context.Background())
+		clk := newTestClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		job := newScheduleTestJob()
+		opts := []ScheduleOption{WithClock(clk)}
+		if catchUp {
+			opts = append(opts, WithCatchUp())
+		}
+		errs := make(chan error, 10)
+		opts = append(opts, WithRunExitCb(func(err error) { errs <- err }))
+		sr := NewScheduledRoutine(Every(time.Minute), job.execute, opts...)
+		go func() { _ = sr.Execute(ctx) }()
+
+		// miss several runs
+		clk.waitTimer(t)
+		clk.Advance(time.Minute * 5)
+		clk.waitTimer(t)
+		if catchUp {
+			job.expectStart(t)
+			job.release <- struct{}{}
+			if err := <-errs; err != nil {
+				t.Fatal(err.Error())
+			}
+		} else {
+			job.expectNoStart(t)
+		}
+
+		// the next run is scheduled in the future
+		clk.waitTimer(t)
+		clk.Advance(time.Minute)
+		job.expectStart(t)
+		ctxCancel()
+	}
+}
+
+// TestParseCron tests parsing cron expressions.
+func TestParseCron(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC) // monday
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * sat,sun", time.Date(2024, 1, 6, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 15 * 5", time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"5-10/5 10 * * *", time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		sched, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if next := sched.Next(start); !next.Equal(tc.expected) {
+			t.Fatalf("%s: expected %v but got %v", tc.expr, tc.expected, next)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
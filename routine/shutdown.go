@@ -0,0 +1,68 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// exitCollector collects routine errors while waiting for a shutdown.
+type exitCollector struct {
+	errs []error
+}
+
+// WaitAllExited waits for all running instances of the routine to return.
+//
+// Unlike WaitExited, this also waits for instances which were canceled by a
+// restart or by clearing the context. Does not cancel the routine: use
+// Shutdown to cancel and wait. Returns context.Canceled if ctx is canceled.
+func (k *RoutineContainer) WaitAllExited(ctx context.Context) error {
+	return k.bcast.Wait(ctx, func(broadcast func(), getWaitCh func() <-chan struct{}) (bool, error) {
+		return k.running == 0, nil
+	})
+}
+
+// Shutdown clears the context and waits for the routine to return.
+//
+// Returns a joined error of any errors returned by the routine, either before
+// or during the shutdown. context.Canceled errors returned by the routine are
+// ignored. If ctx is canceled before the routine exited, context.Canceled is
+// also joined.
+//
+// The routine is kept: calling SetContext again restarts the routine.
+func (k *RoutineContainer) Shutdown(ctx context.Context) error {
+	coll := &exitCollector{}
+	k.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		if r := k.routine; r != nil && r.exited && r.err != nil && r.err != context.Canceled {
+			coll.errs = append(coll.errs, r.err)
+		}
+		k.collectors = append(k.collectors, coll)
+	})
+	_ = k.ClearContext()
+
+	waitErr := k.WaitAllExited(ctx)
+
+	var errs []error
+	k.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		k.collectors = slices.DeleteFunc(k.collectors, func(c *exitCollector) bool {
+			return c == coll
+		})
+		errs = coll.errs
+	})
+
+	if waitErr != nil {
+		errs = append(errs, waitErr)
+	}
+	return errors.Join(errs...)
+}
+
+// collectExitLocked records the exit of a routine with any active collectors.
+// expects bcast to be locked by caller
+func (k *RoutineContainer) collectExitLocked(err error) {
+	if err == nil || err == context.Canceled {
+		return
+	}
+	for _, coll := range k.collectors {
+		coll.errs = append(coll.errs, err)
+	}
+}
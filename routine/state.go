@@ -2,8 +2,10 @@ package routine
 
 import (
 	"context"
+	"time"
 
 	proto "github.com/aperturerobotics/protobuf-go-lite"
+	"github.com/aperturerobotics/util/ccontainer"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,9 +18,27 @@ type StateRoutineContainer[T comparable] struct {
 	compare func(t1, t2 T) bool
 	// stateRoutine contains the state routine function
 	stateRoutine StateRoutine[T]
+	// liveRoutine contains the live state routine function
+	// if set, stateRoutine is nil
+	liveRoutine LiveStateRoutine[T]
 	// s contains the current state
 	// guarded by rc.bcast
 	s T
+	// applied contains the state passed to the routine
+	// guarded by rc.bcast
+	applied T
+	// debounceTimer applies the pending state, if any
+	// guarded by rc.bcast
+	debounceTimer *time.Timer
+	// pendingSince is the time of the first pending state change
+	// guarded by rc.bcast
+	pendingSince time.Time
+	// pendingCh is closed when the previous routine exited after the pending state was applied
+	// guarded by rc.bcast
+	pendingCh chan struct{}
+	// liveState contains the state for the running live routine, if any
+	// guarded by rc.bcast
+	liveState *ccontainer.CContainer[T]
 }
 
 // StateRoutine is a function called as a goroutine with a state parameter.
@@ -27,6 +47,16 @@ type StateRoutineContainer[T comparable] struct {
 // If an error is returned, can still be restarted later.
 type StateRoutine[T comparable] func(ctx context.Context, st T) error
 
+// LiveStateRoutine is a function called as a goroutine with a live state.
+//
+// State changes are delivered to the running routine via the Watchable instead
+// of restarting the routine. If a change cannot be applied in place, call
+// restart to cancel ctx and restart the routine with the latest state.
+// If the state changes to empty, ctx will be canceled.
+// If nil is returned, exits cleanly permanently.
+// If an error is returned, can still be restarted later.
+type LiveStateRoutine[T comparable] func(ctx context.Context, state ccontainer.Watchable[T], restart func()) error
+
 // NewStateRoutineContainer constructs a new StateRoutineContainer.
 //
 // Note: routines won't start until SetContext and SetState is called.
@@ -88,6 +118,11 @@ func (s *StateRoutineContainer[T]) GetState() T {
 //
 // Returns if the state changed and if the routine is running.
 // If reset=true the existing routine was canceled or restarted.
+//
+// If WithStateDebounce is set, the state is applied after the debounce delay.
+// In that case reset=true if the existing routine will be restarted and
+// waitReturn is closed when the previous routine exited after the state was
+// applied, or when the pending change is canceled.
 func (s *StateRoutineContainer[T]) SetState(state T) (waitReturn <-chan struct{}, changed, reset, running bool) {
 	s.rc.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
 		waitReturn, changed, reset, running = s.setStateLocked(state, broadcast)
@@ -104,12 +139,75 @@ func (s *StateRoutineContainer[T]) setStateLocked(state T, broadcast func()) (wa
 	}
 	if changed {
 		s.s = state
-		waitReturn, reset, running = s.updateStateRoutineLocked(broadcast)
+		if s.rc.debounceQuiet > 0 {
+			waitReturn, reset, running = s.debounceStateLocked()
+		} else {
+			waitReturn, reset, running = s.updateStateRoutineLocked(broadcast)
+		}
 		broadcast()
 	}
 	return
 }
 
+// debounceStateLocked schedules applying the current state after the debounce delay.
+// expects rc.bcast to be locked by caller
+func (s *StateRoutineContainer[T]) debounceStateLocked() (waitReturn <-chan struct{}, reset, running bool) {
+	running = s.rc.getRunningLocked()
+	if s.compare != nil && s.compare(s.applied, s.s) {
+		// reverted to the applied state
+		s.stopDebounceLocked(nil)
+		return nil, false, running
+	}
+
+	now := time.Now()
+	if s.debounceTimer != nil {
+		s.debounceTimer.Stop()
+	} else {
+		s.pendingSince = now
+		s.pendingCh = make(chan struct{})
+	}
+	delay := s.rc.debounceQuiet
+	if s.rc.debounceMaxDelay > 0 {
+		delay = max(min(delay, s.pendingSince.Add(s.rc.debounceMaxDelay).Sub(now)), 0)
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.rc.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+			if s.debounceTimer == timer {
+				_, _, _ = s.updateStateRoutineLocked(broadcast)
+				broadcast()
+			}
+		})
+	})
+	s.debounceTimer = timer
+
+	prevRoutine := s.rc.routine
+	reset = s.rc.ctx != nil && prevRoutine != nil && !prevRoutine.exited
+	return s.pendingCh, reset, running
+}
+
+// stopDebounceLocked stops the pending debounce, if any.
+// closes the pending channel once waitReturn is closed, if set.
+// expects rc.bcast to be locked by caller
+func (s *StateRoutineContainer[T]) stopDebounceLocked(waitReturn <-chan struct{}) {
+	if s.debounceTimer == nil {
+		return
+	}
+	s.debounceTimer.Stop()
+	s.debounceTimer = nil
+	pendingCh := s.pendingCh
+	s.pendingCh = nil
+	if waitReturn == nil {
+		close(pendingCh)
+	} else {
+		go func() {
+			<-waitReturn
+			close(pendingCh)
+		}()
+	}
+}
+
 // SwapState locks the container, calls the callback, and stores the returned value.
 //
 // Returns the updated value and if the state changed.
@@ -137,6 +235,7 @@ func (s *StateRoutineContainer[T]) SwapValue(cb func(val T) T) (nextState T, wai
 }
 
 // SetStateRoutine sets the routine to execute, resetting the existing, if set.
+// Replaces the live state routine, if set.
 // If the specified routine is nil, shuts down the current routine.
 // Returns if the current routine was stopped or overwritten.
 // Returns a channel which will be closed when the previous routine exits.
@@ -145,7 +244,26 @@ func (s *StateRoutineContainer[T]) SwapValue(cb func(val T) T) (nextState T, wai
 // Note: does not check if routine is equal to the current routine func (cannot compare generic funcs).
 func (s *StateRoutineContainer[T]) SetStateRoutine(routine StateRoutine[T]) (waitReturn <-chan struct{}, reset, running bool) {
 	s.rc.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
-		s.stateRoutine = routine
+		s.stateRoutine, s.liveRoutine = routine, nil
+		s.liveState = nil
+		waitReturn, reset, running = s.updateStateRoutineLocked(broadcast)
+	})
+	return
+}
+
+// SetLiveStateRoutine sets the live routine to execute, resetting the existing, if set.
+// Replaces the state routine, if set.
+//
+// State changes are delivered to the running live routine without restarting it.
+// If the specified routine is nil, shuts down the current routine.
+// Returns if the current routine was stopped or overwritten.
+// Returns a channel which will be closed when the previous routine exits.
+// The waitReturn channel will be nil if there was no previous routine (reset=false).
+// If SetContext has not been called or SetState is empty, returns false for running.
+func (s *StateRoutineContainer[T]) SetLiveStateRoutine(routine LiveStateRoutine[T]) (waitReturn <-chan struct{}, reset, running bool) {
+	s.rc.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		s.stateRoutine, s.liveRoutine = nil, routine
+		s.liveState = nil
 		waitReturn, reset, running = s.updateStateRoutineLocked(broadcast)
 	})
 	return
@@ -155,6 +273,35 @@ func (s *StateRoutineContainer[T]) SetStateRoutine(routine StateRoutine[T]) (wai
 func (s *StateRoutineContainer[T]) updateStateRoutineLocked(broadcast func()) (waitReturn <-chan struct{}, reset, running bool) {
 	var empty T
 	st, routine := s.s, s.stateRoutine
+	s.applied = st
+	if s.liveRoutine != nil && st != empty {
+		if s.liveState != nil && s.rc.getRunningLocked() {
+			// deliver the state to the running live routine
+			s.liveState.SetValue(st)
+			s.stopDebounceLocked(nil)
+			return nil, false, true
+		}
+		// the live routine is not running: start it with a new live state
+		liveRoutine := s.liveRoutine
+		liveState := ccontainer.NewCContainerWithEqual(st, s.compare)
+		liveWatchable := ccontainer.ToWatchable(liveState)
+		s.liveState = liveState
+		setRoutine := func(ctx context.Context) error {
+			return liveRoutine(ctx, liveWatchable, func() {
+				s.rc.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+					if ctx.Err() == nil && s.liveState == liveState {
+						s.rc.restartRoutineLocked(false, broadcast)
+					}
+				})
+			})
+		}
+		waitReturn, reset = s.rc.setRoutineLocked(setRoutine, broadcast)
+		running = s.rc.getRunningLocked()
+		s.stopDebounceLocked(waitReturn)
+		return
+	}
+	s.liveState = nil
+
 	var setRoutine Routine
 	if routine != nil && st != empty {
 		setRoutine = func(ctx context.Context) error {
@@ -163,6 +310,7 @@ func (s *StateRoutineContainer[T]) updateStateRoutineLocked(broadcast func()) (w
 	}
 	waitReturn, reset = s.rc.setRoutineLocked(setRoutine, broadcast)
 	running = s.rc.getRunningLocked()
+	s.stopDebounceLocked(waitReturn)
 	return
 }
 
@@ -190,6 +338,12 @@ func (s *StateRoutineContainer[T]) RestartRoutine() bool {
 	return s.rc.RestartRoutine()
 }
 
+// GetExitHistory returns the recent runs of the routine from oldest to newest.
+// Returns nil if WithExitHistory was not set.
+func (s *StateRoutineContainer[T]) GetExitHistory() []ExitRecord {
+	return s.rc.GetExitHistory()
+}
+
 // WaitExited waits for the routine to exit and returns the error if any.
 // Note: Will NOT return after the routine is restarted normally.
 // If returnIfNotRunning is set, returns nil if no routine is running.
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	protobuf_go_lite "github.com/aperturerobotics/protobuf-go-lite"
+	"github.com/aperturerobotics/util/ccontainer"
 	"github.com/sirupsen/logrus"
 )
 
@@ -156,3 +157,172 @@ func TestStateRoutineContainer(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// TestStateRoutineContainer_Debounce tests coalescing rapid state changes.
+func TestStateRoutineContainer_Debounce(t *testing.T) {
+	ctx := context.Background()
+	var starts atomic.Int32
+	var lastState atomic.Int32
+	k := NewStateRoutineContainer(
+		protobuf_go_lite.CompareComparable[int](),
+		WithStateDebounce(time.Millisecond*50, time.Millisecond*150),
+	)
+	_, _, _ = k.SetStateRoutine(func(ctx context.Context, st int) error {
+		starts.Add(1)
+		lastState.Store(int32(st))
+		<-ctx.Done()
+		return context.Canceled
+	})
+	k.SetContext(ctx, false)
+
+	// flap the state quickly: expect a single start with the latest state
+	var waitReturn <-chan struct{}
+	for i := 1; i <= 10; i++ {
+		var changed, reset bool
+		waitReturn, changed, reset, _ = k.SetState(i)
+		if !changed || reset || waitReturn == nil {
+			t.Fatalf("unexpected set state result at %d", i)
+		}
+		<-time.After(time.Millisecond * 5)
+	}
+	if k.GetState() != 10 {
+		t.Fatal("expected get state to return the latest state")
+	}
+	select {
+	case <-waitReturn:
+	case <-time.After(time.Second):
+		t.Fatal("expected wait return to be closed")
+	}
+	<-time.After(time.Millisecond * 20)
+	if n := starts.Load(); n != 1 || lastState.Load() != 10 {
+		t.Fatalf("expected 1 start with state 10 but got %d with %d", n, lastState.Load())
+	}
+
+	// reverting to the applied state cancels the restart
+	_, _, reset, _ := k.SetState(11)
+	if !reset {
+		t.Fatal("expected pending reset")
+	}
+	if waitReturn, changed, reset, running := k.SetState(10); !changed || reset || !running || waitReturn != nil {
+		t.Fatal("expected revert to cancel the pending reset")
+	}
+	<-time.After(time.Millisecond * 100)
+	if n := starts.Load(); n != 1 {
+		t.Fatalf("expected 1 start but got %d", n)
+	}
+
+	// continuous changes are applied after the max delay
+	for i := 20; i < 50; i++ {
+		_, _, _, _ = k.SetState(i)
+		<-time.After(time.Millisecond * 10)
+	}
+	if n := starts.Load(); n < 2 {
+		t.Fatalf("expected max delay to restart the routine: %d starts", n)
+	}
+	k.ClearContext()
+}
+
+// TestStateRoutineContainer_Live tests delivering state changes to a live routine.
+func TestStateRoutineContainer_Live(t *testing.T) {
+	ctx := context.Background()
+	var starts atomic.Int32
+	vals := make(chan int, 10)
+	restartCh := make(chan func(), 1)
+	k := NewStateRoutineContainer(protobuf_go_lite.CompareComparable[int]())
+	_, _, _ = k.SetLiveStateRoutine(func(ctx context.Context, state ccontainer.Watchable[int], restart func()) error {
+		starts.Add(1)
+		select {
+		case restartCh <- restart:
+		default:
+		}
+		var prev int
+		for {
+			val, err := state.WaitValueChange(ctx, prev, nil)
+			if err != nil {
+				return err
+			}
+			vals <- val
+			prev = val
+		}
+	})
+	k.SetContext(ctx, false)
+
+	for i := 1; i <= 3; i++ {
+		if _, changed, reset, running := k.SetState(i); !changed || reset || !running {
+			t.Fatalf("unexpected set state result at %d", i)
+		}
+		select {
+		case val := <-vals:
+			if val != i {
+				t.Fatalf("expected %d but got %d", i, val)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected live state update")
+		}
+	}
+	if n := starts.Load(); n != 1 {
+		t.Fatalf("expected 1 start but got %d", n)
+	}
+
+	// request a full restart
+	(<-restartCh)()
+	select {
+	case val := <-vals:
+		if val != 3 {
+			t.Fatalf("expected latest state after restart but got %d", val)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected restart")
+	}
+	if n := starts.Load(); n != 2 {
+		t.Fatalf("expected 2 starts but got %d", n)
+	}
+
+	// empty state stops the routine
+	if waitReturn, _, reset, running := k.SetState(0); !reset || running {
+		t.Fatal("expected empty state to stop the routine")
+	} else {
+		<-waitReturn
+	}
+}
+
+func TestStateRoutineContainer_LiveExitedRestarts(t *testing.T) {
+	ctx := context.Background()
+	var starts atomic.Int32
+	exited := make(chan struct{}, 1)
+	k := NewStateRoutineContainer(protobuf_go_lite.CompareComparable[int]())
+	_, _, _ = k.SetLiveStateRoutine(func(ctx context.Context, state ccontainer.Watchable[int], restart func()) error {
+		starts.Add(1)
+		// exit as soon as the state is even
+		_, err := state.WaitValueWithValidator(ctx, func(v int) (bool, error) {
+			return v%2 == 0, nil
+		}, nil)
+		exited <- struct{}{}
+		return err
+	})
+	k.SetContext(ctx, false)
+
+	_, _, _, _ = k.SetState(1)
+	_, _, _, _ = k.SetState(2)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("expected live routine to exit")
+	}
+	if err := k.WaitExited(ctx, true, nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// the next state restarts the exited live routine
+	if _, changed, _, running := k.SetState(4); !changed || !running {
+		t.Fatal("expected new state to restart the live routine")
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("expected live routine to restart")
+	}
+	if n := starts.Load(); n != 2 {
+		t.Fatalf("expected 2 starts but got %d", n)
+	}
+}
@@ -0,0 +1,480 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aperturerobotics/util/backoff"
+	"github.com/aperturerobotics/util/broadcast"
+)
+
+// ErrMaxRestartIntensity is returned by a Supervisor when the children were
+// restarted more than the max restart intensity allows.
+var ErrMaxRestartIntensity = errors.New("supervisor: max restart intensity exceeded")
+
+// ErrSupervisorRunning is returned if Execute is called on a running Supervisor.
+var ErrSupervisorRunning = errors.New("supervisor: already running")
+
+// RestartStrategy is the strategy used by a Supervisor when a child fails.
+type RestartStrategy int
+
+const (
+	// OneForOne restarts only the failed child.
+	OneForOne RestartStrategy = iota
+	// OneForAll stops all other children and restarts all children.
+	OneForAll
+	// RestForOne stops the children after the failed child and restarts the
+	// failed child and the children after it, in order.
+	RestForOne
+)
+
+// String returns the name of the restart strategy.
+func (s RestartStrategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one-for-one"
+	case OneForAll:
+		return "one-for-all"
+	case RestForOne:
+		return "rest-for-one"
+	default:
+		return "unknown"
+	}
+}
+
+// Supervisor supervises an ordered set of named child routines.
+//
+// Children are started in order when Execute is called. If a child returns
+// nil it exits cleanly permanently. If a child returns an error, the children
+// are restarted according to the RestartStrategy. If there are more than
+// maxRestarts restarts within period, all children are stopped and Execute
+// returns ErrMaxRestartIntensity, escalating the failure to the parent.
+//
+// Supervisor.Execute is a Routine: supervisors can be nested by adding the
+// Execute function of a Supervisor as a child of another Supervisor, or run
+// with a RoutineContainer.
+type Supervisor struct {
+	// strategy is the restart strategy
+	strategy RestartStrategy
+	// maxRestarts is the max number of restarts within period.
+	// if < 0, the restart intensity is not limited.
+	maxRestarts int
+	// period is the max restart intensity window
+	period time.Duration
+	// settings are the settings shared with RoutineContainer.
+	// retryBo delays restarts and the exit history is kept per child.
+	settings
+
+	// bcast guards below fields
+	bcast broadcast.Broadcast
+	// ctx is the context of the running Execute call
+	// nil if not running
+	ctx context.Context
+	// children is the ordered list of children
+	children []*supervisorChild
+	// exits is the queue of child exits to handle
+	exits []supervisorChildExit
+	// restarts contains the times of restarts within the period
+	restarts []time.Time
+}
+
+// supervisorChild is a child routine of a Supervisor.
+type supervisorChild struct {
+	// name is the name of the child
+	name string
+	// routine is the child routine
+	routine Routine
+
+	// fields guarded by bcast
+	// runID is incremented each time the child is started or stopped
+	runID uint64
+	// ctxCancel cancels the running child
+	ctxCancel context.CancelFunc
+	// exitedCh is closed when the running child exits
+	exitedCh <-chan struct{}
+	// running indicates the child is running
+	running bool
+	// done indicates the child exited cleanly
+	done bool
+	// exitHistory is the history of runs, if enabled.
+	exitHistory *ExitHistory
+}
+
+// supervisorChildExit is an exit of a child routine.
+type supervisorChildExit struct {
+	// child is the child that exited
+	child *supervisorChild
+	// runID is the runID of the child when it was started
+	runID uint64
+	// err is the error returned by the child
+	err error
+}
+
+// NewSupervisor constructs a new Supervisor.
+//
+// If there are more than maxRestarts restarts within period, the Supervisor
+// stops all children and returns ErrMaxRestartIntensity. If maxRestarts < 0,
+// the restart intensity is not limited.
+//
+// The WithRetry and WithBackoff options delay restarts of failed children.
+// The backoff is reset when there were no restarts within period.
+// The WithExitCb options are called each time a child exits.
+// The WithPanicRecovery option recovers panics in the children as errors.
+// The WithHeartbeat option fails a child with ErrStalled if it does not call
+// Heartbeat within the interval. The stalled child is restarted without
+// waiting for it to return.
+// The WithExitHistory option keeps the recent runs of each child, see
+// GetChildExitHistory.
+func NewSupervisor(strategy RestartStrategy, maxRestarts int, period time.Duration, opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		strategy:    strategy,
+		maxRestarts: maxRestarts,
+		period:      period,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.ApplyToSupervisor(s)
+		}
+	}
+	return s
+}
+
+// AddChild adds a named child routine to the end of the list of children.
+//
+// If the Supervisor is running, starts the child immediately.
+// Returns false if a child with the name already exists or routine is nil.
+func (s *Supervisor) AddChild(name string, routine Routine) bool {
+	if routine == nil {
+		return false
+	}
+	var added bool
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		if s.getChildLocked(name) != nil {
+			return
+		}
+		c := &supervisorChild{
+			name:        name,
+			routine:     routine,
+			exitHistory: NewExitHistory(s.exitHistorySize),
+		}
+		s.children = append(s.children, c)
+		if s.ctx != nil {
+			s.startChildLocked(c, broadcast)
+		}
+		added = true
+	})
+	return added
+}
+
+// RemoveChild stops and removes the named child routine.
+//
+// Returns a channel which is closed when the child exits, or nil if the child
+// was not running, and if the child existed.
+func (s *Supervisor) RemoveChild(name string) (waitReturn <-chan struct{}, existed bool) {
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		c := s.getChildLocked(name)
+		if c == nil {
+			return
+		}
+		existed = true
+		waitReturn = s.stopChildLocked(c)
+		s.children = slices.DeleteFunc(s.children, func(sc *supervisorChild) bool {
+			return sc == c
+		})
+	})
+	return
+}
+
+// GetChildren returns the names of the children in order.
+func (s *Supervisor) GetChildren() []string {
+	var names []string
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		names = make([]string, len(s.children))
+		for i, c := range s.children {
+			names[i] = c.name
+		}
+	})
+	return names
+}
+
+// GetChildExitHistory returns the recent runs of the named child from oldest
+// to newest. Returns nil if WithExitHistory was not set or the child does not
+// exist.
+func (s *Supervisor) GetChildExitHistory(name string) []ExitRecord {
+	var records []ExitRecord
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		if c := s.getChildLocked(name); c != nil {
+			records = c.exitHistory.Records()
+		}
+	})
+	return records
+}
+
+// Execute starts the children and supervises them until ctx is canceled.
+//
+// Returns nil if all children exited cleanly.
+// Returns an error wrapping ErrMaxRestartIntensity and the last child error if
+// the max restart intensity was exceeded.
+// Returns context.Canceled if ctx is canceled.
+// All children have exited when Execute returns, except for stalled children
+// which did not return yet.
+func (s *Supervisor) Execute(ctx context.Context) error {
+	var running bool
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		if s.ctx != nil {
+			running = true
+			return
+		}
+		s.ctx = ctx
+		s.exits = nil
+		s.restarts = nil
+		if s.retryBo != nil {
+			s.retryBo.Reset()
+		}
+		for _, c := range s.children {
+			s.startChildLocked(c, broadcast)
+		}
+	})
+	if running {
+		return ErrSupervisorRunning
+	}
+	defer s.stopAll()
+
+	for {
+		var exit supervisorChildExit
+		var hasExit, allDone bool
+		var waitCh <-chan struct{}
+		s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+			if len(s.exits) != 0 {
+				exit, hasExit = s.exits[0], true
+				s.exits[0] = supervisorChildExit{}
+				s.exits = s.exits[1:]
+				return
+			}
+			allDone = len(s.children) != 0
+			for _, c := range s.children {
+				if !c.done {
+					allDone = false
+					break
+				}
+			}
+			waitCh = getWaitCh()
+		})
+		if allDone {
+			return nil
+		}
+		if !hasExit {
+			select {
+			case <-ctx.Done():
+				return context.Canceled
+			case <-waitCh:
+			}
+			continue
+		}
+
+		for _, cb := range s.exitedCbs {
+			cb(exit.err)
+		}
+		if exit.err == nil {
+			continue
+		}
+		if err := s.restartChildren(ctx, exit); err != nil {
+			return err
+		}
+	}
+}
+
+// restartChildren restarts the children after a child failed.
+func (s *Supervisor) restartChildren(ctx context.Context, exit supervisorChildExit) error {
+	var restart []*supervisorChild
+	var waitChs []<-chan struct{}
+	var escalate bool
+	var delay time.Duration
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		idx := slices.Index(s.children, exit.child)
+		if idx < 0 || exit.child.running || exit.child.runID != exit.runID {
+			// child was removed or restarted
+			return
+		}
+
+		// check the restart intensity
+		now := time.Now()
+		restarts := s.restarts[:0]
+		for _, t := range s.restarts {
+			if now.Sub(t) < s.period {
+				restarts = append(restarts, t)
+			}
+		}
+		if len(restarts) == 0 && s.retryBo != nil {
+			s.retryBo.Reset()
+		}
+		s.restarts = append(restarts, now)
+		if s.maxRestarts >= 0 && len(s.restarts) > s.maxRestarts {
+			escalate = true
+			return
+		}
+
+		switch s.strategy {
+		case OneForAll:
+			restart = slices.Clone(s.children)
+		case RestForOne:
+			restart = slices.Clone(s.children[idx:])
+		default:
+			restart = []*supervisorChild{exit.child}
+		}
+		restart = slices.DeleteFunc(restart, func(c *supervisorChild) bool {
+			return c != exit.child && !c.running
+		})
+		for _, c := range restart {
+			if waitCh := s.stopChildLocked(c); waitCh != nil {
+				waitChs = append(waitChs, waitCh)
+			}
+		}
+		if s.retryBo != nil {
+			delay = s.retryBo.NextBackOff()
+		}
+	})
+	if escalate {
+		return fmt.Errorf("%w: %s: %w", ErrMaxRestartIntensity, exit.child.name, exit.err)
+	}
+	if len(restart) == 0 {
+		return nil
+	}
+
+	// wait for the stopped children to exit
+	for _, waitCh := range waitChs {
+		select {
+		case <-ctx.Done():
+			return context.Canceled
+		case <-waitCh:
+		}
+	}
+
+	// wait for the backoff
+	if delay == backoff.Stop {
+		return fmt.Errorf("%s: %w", exit.child.name, exit.err)
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Canceled
+		case <-timer.C:
+		}
+	}
+
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		if s.ctx != ctx {
+			return
+		}
+		for _, c := range restart {
+			if !c.running && slices.Contains(s.children, c) {
+				s.startChildLocked(c, broadcast)
+			}
+		}
+	})
+	return nil
+}
+
+// getChildLocked returns the child with the name or nil.
+// expects bcast to be locked by caller
+func (s *Supervisor) getChildLocked(name string) *supervisorChild {
+	for _, c := range s.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// startChildLocked starts the child routine.
+// expects bcast to be locked by caller and s.ctx to be set
+func (s *Supervisor) startChildLocked(c *supervisorChild, broadcast func()) {
+	c.runID++
+	runID := c.runID
+	ctx, ctxCancel := context.WithCancel(s.ctx)
+	exitedCh := make(chan struct{})
+	c.ctxCancel, c.exitedCh = ctxCancel, exitedCh
+	c.running, c.done = true, false
+	go func() {
+		exec := NewExecution(s.heartbeat, s.recoverPanics)
+		err := exec.Run(ctx, c.routine, func() {
+			// mark the child as exited without waiting for it to return
+			s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+				s.childExitedLocked(c, runID, exec.Started(), ErrStalled, false, broadcast)
+			})
+		})
+		canceled := ctx.Err() != nil
+		ctxCancel()
+		close(exitedCh)
+		s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+			if exec.Handle() {
+				s.childExitedLocked(c, runID, exec.Started(), err, canceled, broadcast)
+			}
+		})
+	}()
+	broadcast()
+}
+
+// childExitedLocked handles the exit of the child run with runID.
+// canceled indicates the child context was canceled before the child exited.
+// expects bcast to be locked by caller
+func (s *Supervisor) childExitedLocked(
+	c *supervisorChild,
+	runID uint64,
+	started time.Time,
+	err error,
+	canceled bool,
+	broadcast func(),
+) {
+	if c.exitHistory != nil {
+		c.exitHistory.Push(NewExitRecord(started, err, canceled, 0))
+	}
+	if c.runID != runID {
+		// stopped by the supervisor
+		return
+	}
+	c.running = false
+	c.done = err == nil
+	c.ctxCancel()
+	c.ctxCancel, c.exitedCh = nil, nil
+	s.exits = append(s.exits, supervisorChildExit{child: c, runID: runID, err: err})
+	broadcast()
+}
+
+// stopChildLocked cancels the child routine, if running.
+// Returns a channel which is closed when the child exits or nil if not running.
+// expects bcast to be locked by caller
+func (s *Supervisor) stopChildLocked(c *supervisorChild) <-chan struct{} {
+	c.runID++
+	if !c.running {
+		return nil
+	}
+	c.running = false
+	c.ctxCancel()
+	exitedCh := c.exitedCh
+	c.ctxCancel, c.exitedCh = nil, nil
+	return exitedCh
+}
+
+// stopAll stops all children and waits for them to exit.
+func (s *Supervisor) stopAll() {
+	var waitChs []<-chan struct{}
+	s.bcast.HoldLock(func(broadcast func(), getWaitCh func() <-chan struct{}) {
+		for _, c := range s.children {
+			if waitCh := s.stopChildLocked(c); waitCh != nil {
+				waitChs = append(waitChs, waitCh)
+			}
+		}
+		s.ctx = nil
+		s.exits = nil
+		broadcast()
+	})
+	for _, waitCh := range waitChs {
+		<-waitCh
+	}
+}
@@ -0,0 +1,192 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// supervisorTestChild is a child which counts starts and fails on demand.
+type supervisorTestChild struct {
+	starts atomic.Int32
+	fail   chan error
+}
+
+func newSupervisorTestChild() *supervisorTestChild {
+	return &supervisorTestChild{fail: make(chan error, 1)}
+}
+
+func (c *supervisorTestChild) execute(ctx context.Context) error {
+	c.starts.Add(1)
+	select {
+	case <-ctx.Done():
+		return context.Canceled
+	case err := <-c.fail:
+		return err
+	}
+}
+
+// waitStarts waits for the child to be started n times.
+func (c *supervisorTestChild) waitStarts(t *testing.T, n int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.starts.Load() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d starts but got %d", n, c.starts.Load())
+		}
+		<-time.After(time.Millisecond * 5)
+	}
+}
+
+// TestSupervisor_Strategies tests the supervisor restart strategies.
+func TestSupervisor_Strategies(t *testing.T) {
+	cases := []struct {
+		strategy RestartStrategy
+		// expected starts of a, b, c after b fails
+		starts [3]int32
+	}{
+		{OneForOne, [3]int32{1, 2, 1}},
+		{OneForAll, [3]int32{2, 2, 2}},
+		{RestForOne, [3]int32{1, 2, 2}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.strategy.String(), func(t *testing.T) {
+			ctx, ctxCancel := context.WithCancel(context.Background())
+			defer ctxCancel()
+
+			sup := NewSupervisor(tc.strategy, 5, time.Second)
+			children := [3]*supervisorTestChild{}
+			for i, name := range []string{"a", "b", "c"} {
+				children[i] = newSupervisorTestChild()
+				if !sup.AddChild(name, children[i].execute) {
+					t.Fatal("expected add child to succeed")
+				}
+			}
+			if sup.AddChild("a", children[0].execute) {
+				t.Fatal("expected add duplicate child to fail")
+			}
+
+			errCh := make(chan error, 1)
+			go func() { errCh <- sup.Execute(ctx) }()
+			for _, c := range children {
+				c.waitStarts(t, 1)
+			}
+
+			children[1].fail <- errors.New("test error")
+			for i, c := range children {
+				c.waitStarts(t, tc.starts[i])
+			}
+			<-time.After(time.Millisecond * 50)
+			for i, c := range children {
+				if n := c.starts.Load(); n != tc.starts[i] {
+					t.Fatalf("child %d: expected %d starts but got %d", i, tc.starts[i], n)
+				}
+			}
+
+			ctxCancel()
+			if err := <-errCh; err != context.Canceled {
+				t.Fatalf("expected context canceled but got %v", err)
+			}
+		})
+	}
+}
+
+// TestSupervisor_Escalate tests escalating to a parent supervisor.
+func TestSupervisor_Escalate(t *testing.T) {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+
+	child := newSupervisorTestChild()
+	inner := NewSupervisor(OneForOne, 1, time.Minute)
+	inner.AddChild("child", child.execute)
+
+	var escalated atomic.Pointer[error]
+	outer := NewSupervisor(OneForOne, 0, time.Minute, WithExitCb(func(err error) {
+		if err != nil {
+			escalated.Store(&err)
+		}
+	}))
+	outer.AddChild("inner", inner.Execute)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- outer.Execute(ctx) }()
+
+	// first failure is restarted by the inner supervisor
+	child.waitStarts(t, 1)
+	child.fail <- errors.New("test error 1")
+	child.waitStarts(t, 2)
+
+	// second failure exceeds the inner intensity and escalates
+	child.fail <- errors.New("test error 2")
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrMaxRestartIntensity) {
+			t.Fatalf("expected max restart intensity error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected outer supervisor to exit")
+	}
+	if ep := escalated.Load(); ep == nil || !errors.Is(*ep, ErrMaxRestartIntensity) {
+		t.Fatal("expected inner supervisor to escalate")
+	}
+}
+
+// TestSupervisor_CleanExit tests that the supervisor exits when all children exit cleanly.
+func TestSupervisor_CleanExit(t *testing.T) {
+	sup := NewSupervisor(OneForAll, 1, time.Second)
+	var runs atomic.Int32
+	sup.AddChild("a", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	sup.AddChild("b", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	if err := sup.Execute(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if n := runs.Load(); n != 2 {
+		t.Fatalf("expected 2 runs but got %d", n)
+	}
+}
+
+// TestSupervisor_Options tests the heartbeat and exit history options.
+func TestSupervisor_Options(t *testing.T) {
+	sup := NewSupervisor(OneForOne, 1, time.Second, WithHeartbeat(20*time.Millisecond), WithExitHistory(4))
+
+	// the first run stalls without watching ctx
+	release := make(chan struct{})
+	defer close(release)
+	var runs atomic.Int32
+	sup.AddChild("child", func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			<-release
+		}
+		return nil
+	})
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- sup.Execute(context.Background()) }()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected stalled child to be restarted")
+	}
+
+	records := sup.GetChildExitHistory("child")
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records but got %d", len(records))
+	}
+	if !errors.Is(records[0].Err, ErrStalled) || !records[0].Failed() {
+		t.Fatalf("expected stalled run to be recorded: %v", records[0])
+	}
+	if records[1].Err != nil {
+		t.Fatalf("expected clean exit to be recorded: %v", records[1])
+	}
+}